@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consumes the messages of an AMQP queue, like a RabbitMQ one, acknowledging each
+// explicitly, so that those that weren't are delivered again after a restart.
+type amqpSource struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	deliveries <-chan amqp.Delivery
+}
+
+// Connects to the broker at `rawURL` and starts consuming `queue`, with up to
+// `prefetch` messages delivered ahead.
+func openAMQP(rawURL, queue string, prefetch int) (*amqpSource, error) {
+	conn, err := amqp.Dial(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to '%s': %s", dsnName(rawURL), err)
+	}
+	channel, err := conn.Channel()
+	if err == nil {
+		err = channel.Qos(prefetch, 0, false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	deliveries, err := channel.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to consume from queue '%s': %s", queue, err)
+	}
+	return &amqpSource{conn: conn, channel: channel, deliveries: deliveries}, nil
+}
+
+func (a *amqpSource) receive(ctx context.Context) (*message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, errWatchStopped
+	case d, ok := <-a.deliveries:
+		if !ok {
+			return nil, errors.New("the broker closed the channel")
+		}
+		return &message{
+			body:   d.Body,
+			ack:    func() error { return d.Ack(false) },
+			retry:  func() error { return d.Nack(false, true) },
+			reject: func() error { return d.Reject(false) },
+		}, nil
+	}
+}
+
+func (a *amqpSource) Close() error {
+	a.channel.Close()
+	return a.conn.Close()
+}
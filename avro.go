@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Reads the records of an Avro object container file, like csv.Reader. The first
+// row is a header of the fields of the record schema embedded in the file, and
+// each record's values are returned in that order, a block at a time, so that
+// memory use doesn't grow with the size of the file.
+//
+// Values are read as text, as a database's are: null is empty, times are in RFC
+// 3339 format, and records, arrays and maps are JSON. Bytes and fixed values are
+// encoded according to -encoding, so that images stored as bytes are converted as
+// they are.
+type avroReader struct {
+	ocf      *goavro.OCFReader
+	encoding string
+	header   []string
+	// The type of each field, without any null it's a union with, and whether
+	// it's a union, whose values are wrapped in a map keyed by their type.
+	types  []string
+	unions []bool
+	// Whether the header's been returned.
+	started bool
+}
+
+// The parts of an Avro schema that say what its fields are.
+type avroSchema struct {
+	Type   interface{} `json:"type"`
+	Fields []struct {
+		Name string      `json:"name"`
+		Type interface{} `json:"type"`
+	} `json:"fields"`
+}
+
+// Starts reading the container file read from `r`, whose header holds the schema.
+func newAvroReader(r io.Reader, encoding string) (*avroReader, error) {
+	ocf, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Avro file: %s", err)
+	}
+
+	var schema avroSchema
+	if err := json.Unmarshal([]byte(ocf.Codec().Schema()), &schema); err != nil {
+		return nil, fmt.Errorf("failed to read the Avro file's schema: %s", err)
+	}
+	if schema.Type != "record" {
+		return nil, fmt.Errorf("expected the Avro file's schema to be a record, got %s", ocf.Codec().Schema())
+	}
+
+	a := &avroReader{ocf: ocf, encoding: encoding}
+	for _, field := range schema.Fields {
+		t, union := avroType(field.Type)
+		a.header = append(a.header, field.Name)
+		a.types = append(a.types, t)
+		a.unions = append(a.unions, union)
+	}
+	return a, nil
+}
+
+// Returns the name of a field's type: a primitive type like 'string' or 'bytes', a
+// complex one like 'record', or a logical one like 'timestamp-millis'. A union of a
+// type with null is the other type, and any other union is 'union'. Also reports
+// whether the type is a union.
+func avroType(t interface{}) (name string, union bool) {
+	switch t := t.(type) {
+	case string:
+		return t, false
+	case map[string]interface{}:
+		if logical, ok := t["logicalType"].(string); ok {
+			return logical, false
+		}
+		name, _ := t["type"].(string)
+		return name, false
+	case []interface{}:
+		name = "union"
+		branches := 0
+		for _, branch := range t {
+			if branch == "null" {
+				continue
+			}
+			branches++
+			name, _ = avroType(branch)
+		}
+		if branches > 1 {
+			name = "union"
+		}
+		return name, true
+	default:
+		return "", false
+	}
+}
+
+// Returns the names of the first string field and the first bytes field, if there
+// are any, to serve as the identifier and data columns when they aren't given.
+func (a *avroReader) schemaColumns() (id, data string) {
+	for i, t := range a.types {
+		if t == "string" && id == "" {
+			id = a.header[i]
+		}
+		if (t == "bytes" || t == "fixed") && data == "" {
+			data = a.header[i]
+		}
+	}
+	return id, data
+}
+
+func (a *avroReader) Read() ([]string, error) {
+	if !a.started {
+		a.started = true
+		return a.header, nil
+	}
+
+	if !a.ocf.Scan() {
+		if err := a.ocf.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	datum, err := a.ocf.Read()
+	if err != nil {
+		return nil, err
+	}
+	values, ok := datum.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an Avro record, got %T", datum)
+	}
+
+	record := make([]string, len(a.header))
+	for i, name := range a.header {
+		value := values[name]
+		if wrapped, ok := value.(map[string]interface{}); ok && a.unions[i] && len(wrapped) == 1 {
+			for _, v := range wrapped {
+				value = v
+			}
+		}
+		record[i] = a.field(value)
+	}
+	return record, nil
+}
+
+// Returns a value as text.
+func (a *avroReader) field(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return csvimage.EncodeData(v, a.encoding)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		if text, err := json.Marshal(v); err == nil {
+			return string(text)
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// A container file's records are compressed in blocks, so there's no text of
+// them to point to, and none to record either.
+func (a *avroReader) InputOffset() int64 {
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// Opens a blob in Azure Blob Storage, given as 'az://<container>/<blob>', to be
+// read as it downloads. The storage account is given by AZURE_STORAGE_ACCOUNT, or
+// by AZURE_STORAGE_CONNECTION_STRING along with credentials for it. Otherwise
+// credentials are found as the Azure CLI finds them: from the environment, a
+// managed identity, or 'az login'.
+func openAzure(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	container, blob := u.Host, strings.TrimPrefix(u.Path, "/")
+	if container == "" || blob == "" {
+		return nil, fmt.Errorf("invalid Azure URL '%s': must be az://<container>/<blob>", rawURL)
+	}
+
+	client, err := azureClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.DownloadStream(context.Background(), container, blob, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch '%s': %s", rawURL, err)
+	}
+	return resp.Body, nil
+}
+
+// Returns a client for the storage account configured in the environment.
+func azureClient() (*azblob.Client, error) {
+	if conn := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); conn != "" {
+		return azblob.NewClientFromConnectionString(conn, nil)
+	}
+
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if account == "" {
+		return nil, fmt.Errorf("set AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING to read from Azure")
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Azure credentials: %s", err)
+	}
+	return azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", account), cred, nil)
+}
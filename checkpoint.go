@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The name of the checkpoint file written to the output directory.
+const checkpointName = ".csv-image-checkpoint"
+
+// How often the checkpoint is saved while rows are being converted.
+const checkpointInterval = time.Second
+
+// Records how far through a CSV a run has got, so that -resume can pick up where
+// a run that was killed left off. Rows finish out of order, so what's saved is the
+// number of rows at the start of the CSV that have all finished; rows after those
+// may be converted again on resume. Safe for concurrent use, and a nil checkpoint
+// records nothing.
+type checkpoint struct {
+	path string
+	csv  string
+
+	mu    sync.Mutex
+	next  int
+	done  map[int]bool
+	saved time.Time
+}
+
+// The contents of a checkpoint file.
+type checkpointState struct {
+	CSV  string `json:"csv"`
+	Rows int    `json:"rows"`
+}
+
+// Returns a checkpoint for converting the CSV at `csvPath` into `dir`, starting
+// after the first `rows` rows.
+func newCheckpoint(dir, csvPath string, rows int) *checkpoint {
+	return &checkpoint{
+		path: filepath.Join(dir, checkpointName),
+		csv:  csvPath,
+		next: rows + 1,
+		done: map[int]bool{},
+	}
+}
+
+// Returns the number of rows of the CSV at `csvPath` that a previous run into
+// `dir` finished, according to its checkpoint, or 0 if there isn't one.
+func readCheckpoint(dir, csvPath string) (int, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, checkpointName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var state checkpointState
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return 0, fmt.Errorf("invalid checkpoint in '%s': %s", dir, err)
+	}
+	if state.CSV != csvPath {
+		return 0, fmt.Errorf("the checkpoint in '%s' is for '%s', not '%s'", dir, state.CSV, csvPath)
+	}
+	return state.Rows, nil
+}
+
+// Records that a row has finished, whether it was converted or skipped, saving
+// the checkpoint if it hasn't been saved for a while.
+func (c *checkpoint) complete(row int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done[row] = true
+	for c.done[c.next] {
+		delete(c.done, c.next)
+		c.next++
+	}
+
+	if time.Since(c.saved) >= checkpointInterval {
+		c.save()
+	}
+}
+
+// Saves the checkpoint, once every row has finished.
+func (c *checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+// Writes the checkpoint to a temporary file that's renamed into place, so that it's
+// never left half written. Must be called with the mutex held.
+func (c *checkpoint) save() error {
+	c.saved = time.Now()
+
+	contents, err := json.Marshal(checkpointState{CSV: c.csv, Rows: c.next - 1})
+	if err != nil {
+		return err
+	}
+	partial := c.path + ".partial"
+	if err := ioutil.WriteFile(partial, contents, 0666); err != nil {
+		return err
+	}
+	return os.Rename(partial, c.path)
+}
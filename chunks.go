@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returned by chunkedSource for an image whose parts can't be put back together.
+// Reading can continue with the next image.
+type chunkError struct {
+	id  string
+	err string
+}
+
+func (e *chunkError) Error() string {
+	return fmt.Sprintf("parts of %s %s", e.id, e.err)
+}
+
+// Joins image data that's been split across several rows, as '<identifier>,<part>,
+// <data>' for instance, into a single record for each image. The rows of an image
+// must be next to each other, but may be in any order, as they're sorted by their
+// part numbers. The fields of an image's record are those of its first row, with
+// the data replaced by the whole of it.
+type chunkedSource struct {
+	in      *csvInput
+	partCol int
+
+	// The first row of the next image, read while looking for the end of the last.
+	next []string
+	// An error that ended the last image, to be returned after that image.
+	err error
+	// The identifiers of the images returned so far, to catch rows that aren't
+	// next to the others for their image.
+	seen   map[string]bool
+	record []string
+}
+
+func newChunkedSource(in *csvInput, partCol int) *chunkedSource {
+	return &chunkedSource{in: in, partCol: partCol, seen: map[string]bool{}}
+}
+
+func (s *chunkedSource) Next() (id, data string, err error) {
+	if s.err != nil {
+		err, s.err = s.err, nil
+		return "", "", err
+	}
+
+	var rows [][]string
+	if s.next != nil {
+		rows = append(rows, s.next)
+		s.next = nil
+	}
+	for {
+		_, _, err := s.in.Next()
+		if err != nil {
+			if rows == nil {
+				return "", "", err
+			}
+			if err != io.EOF {
+				s.err = err
+			}
+			break
+		}
+
+		record := s.in.Fields()
+		if rows != nil && record[s.in.IDColumn] != rows[0][s.in.IDColumn] {
+			s.next = record
+			break
+		}
+		rows = append(rows, record)
+	}
+
+	s.record = rows[0]
+	id = s.record[s.in.IDColumn]
+	if s.seen[id] {
+		return "", "", &chunkError{id, "aren't all in adjacent rows"}
+	}
+	s.seen[id] = true
+
+	data, err = s.join(rows)
+	if err != nil {
+		return "", "", &chunkError{id, err.Error()}
+	}
+	s.record = append([]string(nil), s.record...)
+	s.record[s.in.DataColumn] = data
+	return id, data, nil
+}
+
+// Joins the data of an image's rows in the order of their part numbers, which
+// must follow on from each other.
+func (s *chunkedSource) join(rows [][]string) (string, error) {
+	parts := make([]int, len(rows))
+	for i, record := range rows {
+		if s.partCol >= len(record) {
+			return "", fmt.Errorf("have no part column")
+		}
+		part, err := strconv.Atoi(strings.TrimSpace(record[s.partCol]))
+		if err != nil {
+			return "", fmt.Errorf("have an invalid part number '%s'", record[s.partCol])
+		}
+		parts[i] = part
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return parts[order[i]] < parts[order[j]] })
+
+	var data strings.Builder
+	size := 0
+	for _, record := range rows {
+		size += len(record[s.in.DataColumn])
+	}
+	data.Grow(size)
+	for i, row := range order {
+		if i > 0 && parts[row] != parts[order[i-1]]+1 {
+			return "", fmt.Errorf("are missing or repeated: part %d follows part %d", parts[row], parts[order[i-1]])
+		}
+		data.WriteString(rows[row][s.in.DataColumn])
+	}
+	return data.String(), nil
+}
+
+func (s *chunkedSource) Fields() []string {
+	return s.record
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats CSV files may be stored in, selected with -compression.
+// "auto" picks one from the file's extension.
+var compressions = []string{"auto", "none", "gzip", "zstd", "brotli"}
+
+// File extensions of compressed CSVs, and the compression each implies.
+var compressionExtensions = map[string]string{
+	".gz":  "gzip",
+	".zst": "zstd",
+	".br":  "brotli",
+}
+
+// Checks that `compression` is one of the supported -compression values.
+func validateCompression(compression string) error {
+	for _, c := range compressions {
+		if c == compression {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported -compression '%s': must be one of %s", compression, strings.Join(compressions, ", "))
+}
+
+// Returns the compression of the file at `path` that starts with `header`:
+// `compression` itself, unless it's "auto", in which case it's inferred from the
+// file's extension or, failing that, the magic number at its start. Brotli has no
+// magic number, so it's only recognized by its extension.
+func detectCompression(path string, header []byte, compression string) string {
+	if compression != "auto" {
+		return compression
+	}
+	for ext, c := range compressionExtensions {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return c
+		}
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// The -csv path that means standard input.
+const stdinPath = "-"
+
+// Opens the file at `path`, or standard input if it's "-", or downloads it if it's
+// a URL, returning a reader of its contents decompressed according to
+// `compression` (see detectCompression). Closing the reader closes the file.
+func openCSV(path, compression string) (io.ReadCloser, error) {
+	var file io.ReadCloser = ioutil.NopCloser(os.Stdin)
+	name := path
+	switch {
+	case isURL(path):
+		body, err := openURL(path)
+		if err != nil {
+			return nil, err
+		}
+		file, name = body, urlPath(path)
+	case path != stdinPath:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+
+	// Put the header back in front of the rest once it's been sniffed, which, unlike
+	// reading through a bufio.Reader, doesn't copy the whole file once more.
+	var header [4]byte
+	n, err := io.ReadFull(file, header[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		file.Close()
+		return nil, err
+	}
+	contents := io.MultiReader(bytes.NewReader(header[:n]), file)
+
+	r, err := decompress(contents, detectCompression(name, header[:n], compression))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &decompressedFile{ReadCloser: r, file: file}, nil
+}
+
+// A decompressing reader along with the file beneath it, which are closed
+// together.
+type decompressedFile struct {
+	io.ReadCloser
+	file io.Closer
+}
+
+func (f *decompressedFile) Close() error {
+	err := f.ReadCloser.Close()
+	if fileErr := f.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// Wraps `r` in a reader that decompresses it. The returned reader must be closed
+// once it's no longer needed, which doesn't close `r`.
+func decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case "brotli":
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Returns `contents` compressed with `compression`.
+func compress(t testing.TB, contents, compression string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	case "brotli":
+		w = brotli.NewWriter(&buf)
+	}
+	if _, err := io.WriteString(w, contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestOpenCompressedCSV(t *testing.T) {
+	contents := "a,b\nc,d\n"
+	tests := []struct {
+		name        string
+		file        string
+		compression string
+		setting     string
+	}{
+		{"zstd by extension", "input.csv.zst", "zstd", "auto"},
+		{"brotli by extension", "input.csv.br", "brotli", "auto"},
+		{"gzip by extension", "input.csv.gz", "gzip", "auto"},
+		{"zstd by magic number", "input.csv", "zstd", "auto"},
+		{"gzip by magic number", "input.dat", "gzip", "auto"},
+		{"brotli by flag", "input.dat", "brotli", "brotli"},
+		{"uncompressed", "input.csv", "", "auto"},
+	}
+
+	for _, test := range tests {
+		stored := contents
+		if test.compression != "" {
+			stored = compress(t, contents, test.compression)
+		}
+		r, err := openCSV(writeTemp(t, test.file, stored), test.setting)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if closeErr := r.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if string(got) != contents {
+			t.Errorf("%s: expected %q, got %q", test.name, contents, got)
+		}
+	}
+}
+
+func TestConvertZstdAndBrotliCSVs(t *testing.T) {
+	row := "a," + pngData(t) + "\n"
+	for _, file := range []struct{ name, compression string }{{"input.csv.zst", "zstd"}, {"input.csv.br", "brotli"}} {
+		opts := testOptions(t.TempDir())
+		stats := newSummary()
+		if err := convertFile(context.Background(), writeTemp(t, file.name, compress(t, row, file.compression)), opts, stats); err != nil {
+			t.Fatalf("%s: %s", file.name, err)
+		}
+		if stats.success != 1 {
+			t.Errorf("%s: expected the image to be written, got %s", file.name, stats)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The prefix of environment variables that set flags.
+const envPrefix = "CSVIMAGE_"
+
+// Returns the environment variable that sets a flag: the flag's name in upper case,
+// with dashes replaced by underscores and the prefix added, like CSVIMAGE_OUTPUT
+// for -output.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// Sets flags that weren't given on the command line from environment variables.
+func applyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %s", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// The config file read from the working directory when -config isn't given.
+const defaultConfig = "csv-image.yaml"
+
+// Sets flags from a YAML config file whose keys are flag names, like:
+//
+//	csv: exports/images.csv
+//	output: images
+//	concurrency: 4
+//	meta-cols: [2, 3]
+//
+// Flags given on the command line or by environment variables take precedence over
+// the file. If `path` is empty, the default config is read if it exists.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		if _, err := os.Stat(defaultConfig); err != nil {
+			return nil
+		}
+		path = defaultConfig
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return fmt.Errorf("invalid config '%s': %s", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("invalid config '%s': unknown option '%s'", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		if list, ok := values[name].([]interface{}); ok {
+			if _, repeatable := fs.Lookup(name).Value.(*pathList); repeatable {
+				// Like giving the flag once for each item.
+				for _, item := range list {
+					if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+						return fmt.Errorf("invalid config '%s': %s: %s", path, name, err)
+					}
+				}
+				continue
+			}
+		}
+		if err := fs.Set(name, configValue(values[name])); err != nil {
+			return fmt.Errorf("invalid config '%s': %s: %s", path, name, err)
+		}
+	}
+	return nil
+}
+
+// Returns a config value as it would be given on the command line. Lists become
+// comma-separated, as -meta-cols expects.
+func configValue(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
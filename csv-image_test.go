@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Returns options as the flags set them by default, writing to `dir`.
+func testOptions(dir string) *options {
+	return &options{
+		conv:        &csvimage.Converter{Encoding: "base64", JPEG: &jpeg.Options{Quality: 100}},
+		outputDir:   dir,
+		logFormat:   "text",
+		manifest:    true,
+		messages:    ioutil.Discard,
+		sink:        &csvimage.DirSink{Dir: dir},
+		ioRetries:   3,
+		inputFormat: "csv",
+		delimiter:   ',',
+		dataCol:     1,
+		sample:      1,
+		seed:        1,
+		workers:     2,
+		compression: "auto",
+	}
+}
+
+// Returns a `w` by `h` image with a different color in every pixel.
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// Returns an image encoded as a PNG.
+func pngBytes(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Returns an image encoded as a JPEG.
+func jpegBytes(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Returns a small PNG, base-64 encoded as it would be in a CSV.
+func pngData(t testing.TB) string {
+	return base64.StdEncoding.EncodeToString(pngBytes(t, testImage(4, 3)))
+}
+
+// Writes `contents` to a file named `name` in a new temporary directory, and
+// returns its path.
+func writeTemp(t testing.TB, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Converts a CSV with the given contents, returning the summary of the run.
+func convertCSV(t testing.TB, contents string, opts *options) (*summary, error) {
+	t.Helper()
+	stats := newSummary()
+	err := convertFile(context.Background(), writeTemp(t, "input.csv", contents), opts, stats)
+	return stats, err
+}
+
+// Returns the contents of a file in the output directory, failing if it doesn't
+// exist.
+func readOutput(t testing.TB, opts *options, name string) []byte {
+	t.Helper()
+	contents, err := ioutil.ReadFile(filepath.Join(opts.outputDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// Returns the names of the images in the output directory, in lexical order.
+func outputImages(t testing.TB, opts *options) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(opts.outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		if ext := filepath.Ext(f.Name()); ext == ".png" || ext == ".jpeg" {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a CSV of `rows` rows of the same small PNG, identified by their row
+// numbers.
+func numberedCSV(t testing.TB, rows int) string {
+	data := pngData(t)
+	var csv strings.Builder
+	for row := 1; row <= rows; row++ {
+		csv.WriteString(strconv.Itoa(row) + "," + data + "\n")
+	}
+	return csv.String()
+}
+
+// Returns the rows of the manifest in the output directory, without its header,
+// keyed by identifier.
+func readManifest(t testing.TB, opts *options) map[string][]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(readOutput(t, opts, manifestName))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string][]string{}
+	for _, record := range records[1:] {
+		rows[record[0]] = record
+	}
+	return rows
+}
+
+func TestSingleColumnCSV(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	_, err := convertCSV(t, "only-one-field\nanother\n", opts)
+	if err == nil {
+		t.Fatal("expected an error for a CSV with a single column")
+	}
+	for _, hint := range []string{"only one column", "-delimiter"} {
+		if !strings.Contains(err.Error(), hint) {
+			t.Errorf("error %q doesn't mention %q", err, hint)
+		}
+	}
+}
+
+func TestTooFewColumnsCSV(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.dataCol = 3
+	_, err := convertCSV(t, "a,b,c\n", opts)
+	if err == nil || !strings.Contains(err.Error(), "-data-col") {
+		t.Fatalf("expected an error suggesting -data-col, got %v", err)
+	}
+}
+
+func TestFormatColumn(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.formatColumn = "2"
+	data := pngData(t)
+	contents := "a," + data + ",jpeg\nb," + data + ",PNG\nc," + data + ",tiff\n"
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 3 {
+		t.Fatalf("expected 3 images written, got %d", stats.success)
+	}
+
+	for file, format := range map[string]string{"a.jpeg": "jpeg", "b.png": "png", "c.png": "png"} {
+		if magic := csvimage.SniffMagic(readOutput(t, opts, file)); magic != format {
+			t.Errorf("%s: expected a %s, got %q", file, format, magic)
+		}
+	}
+}
+
+func TestFormatColumnByName(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.header = true
+	opts.formatColumn = "output"
+	opts.metaCols = []string{"all"}
+	data := pngData(t)
+	contents := "id,data,output,caption\na," + data + ",jpeg,first\nb," + data + ",png,second\n"
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 2 {
+		t.Fatalf("expected 2 images written, got %s", stats)
+	}
+	if images := strings.Join(outputImages(t, opts), ","); images != "a.jpeg,b.png" {
+		t.Errorf("expected a.jpeg and b.png, got %s", images)
+	}
+	if meta := string(readOutput(t, opts, "a.json")); strings.Contains(meta, "output") {
+		t.Errorf("expected the format column not to be metadata, got %s", meta)
+	}
+
+	opts.header = false
+	if _, err := convertCSV(t, contents, opts); err == nil || !strings.Contains(err.Error(), "can only be chosen by name with -header") {
+		t.Errorf("expected a format column name to need -header, got %v", err)
+	}
+}
+
+func TestSampleIsDeterministic(t *testing.T) {
+	contents := numberedCSV(t, 50)
+	sample := func(seed int64) ([]string, *summary) {
+		opts := testOptions(t.TempDir())
+		opts.sample, opts.seed = 0.3, seed
+		stats, err := convertCSV(t, contents, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return outputImages(t, opts), stats
+	}
+
+	first, stats := sample(7)
+	if stats.success == 0 || stats.unsampled == 0 || stats.sampled != stats.success || stats.sampled+stats.unsampled != 50 {
+		t.Fatalf("expected some of the 50 rows to be sampled and the rest left out, got %s", stats)
+	}
+	if stats.skipped != 0 {
+		t.Errorf("expected rows left out by -sample not to count as skipped, got %d", stats.skipped)
+	}
+	if len(first) != stats.success {
+		t.Errorf("expected %d images, found %d", stats.success, len(first))
+	}
+	if second, _ := sample(7); strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Errorf("the same seed sampled different rows:\n%v\n%v", first, second)
+	}
+	if other, _ := sample(8); strings.Join(first, ",") == strings.Join(other, ",") {
+		t.Errorf("a different seed sampled the same rows: %v", first)
+	}
+}
+
+func TestSampleCountedApartFromSkipped(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.sample = 0.5
+	opts.filterID = regexp.MustCompile("^[0-9]$")
+	stats, err := convertCSV(t, numberedCSV(t, 40), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rows are filtered before they're sampled, so only rows 1 to 9 are.
+	if stats.skipped != 31 || stats.sampled+stats.unsampled != 9 || stats.sampled != stats.success {
+		t.Fatalf("expected 31 rows filtered and 9 sampled or left out, got %s", stats)
+	}
+	want := fmt.Sprintf("%d of 9 rows read were sampled, and the other %d left out.", stats.sampled, stats.unsampled)
+	if !strings.Contains(stats.String(), want) {
+		t.Errorf("expected the summary to say %q, got %q", want, stats.String())
+	}
+
+	out, err := stats.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf(`"sampled":%d,"unsampled":%d`, stats.sampled, stats.unsampled); !strings.Contains(string(out), want) {
+		t.Errorf("expected %s in the JSON summary, got %s", want, out)
+	}
+}
+
+// Returns a `w` by `h` image of random noise, which PNG can't compress.
+func noiseImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	return img
+}
+
+func TestVeryLongField(t *testing.T) {
+	if testing.Short() {
+		t.Skip("encodes a 20 MB image")
+	}
+	opts := testOptions(t.TempDir())
+	original := pngBytes(t, noiseImage(1500, 2800))
+	data := base64.StdEncoding.EncodeToString(original)
+	if len(data) < 20<<20 {
+		t.Fatalf("expected at least 20 MB of data, got %d bytes", len(data))
+	}
+
+	stats, err := convertCSV(t, "big,"+data+"\nsmall,"+pngData(t)+"\n", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 2 {
+		t.Fatalf("expected both images written, got %s", stats)
+	}
+	if !bytes.Equal(readOutput(t, opts, "big.png"), original) {
+		t.Error("the image written from the long field isn't the original")
+	}
+}
+
+func TestMaxFieldBytes(t *testing.T) {
+	original := pngBytes(t, noiseImage(20, 20))
+	data := base64.StdEncoding.EncodeToString(original)
+	// Quoted data may have line breaks in it, and the data of any row may be
+	// followed by more fields.
+	quoted := data[:100] + "\r\n" + data[100:]
+
+	for _, delimiter := range []rune{',', '¦'} {
+		opts := testOptions(t.TempDir())
+		opts.maxFieldBytes = 64
+		opts.lenient = true
+		opts.delimiter = delimiter
+		d := string(delimiter)
+		contents := "plain" + d + data + "\r\n" +
+			"quoted" + d + "\"" + quoted + "\"\n" +
+			"trailing" + d + data + d + "png\n" +
+			strings.Repeat("x", 100) + d + pngData(t) + "\n"
+
+		stats, err := convertCSV(t, contents, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.success != 3 {
+			t.Fatalf("expected three images written and the row with a long id skipped with %q, got %s", delimiter, stats)
+		}
+		for _, name := range []string{"plain.png", "quoted.png", "trailing.png"} {
+			if !bytes.Equal(readOutput(t, opts, name), original) {
+				t.Errorf("%s isn't the original image with %q", name, delimiter)
+			}
+		}
+		if images := outputImages(t, opts); len(images) != 3 {
+			t.Errorf("expected only three images with %q, got %v", delimiter, images)
+		}
+	}
+}
+
+func TestMaxFieldBytesDeadLetter(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.maxFieldBytes = 16
+	opts.strict = true
+	path := filepath.Join(t.TempDir(), "dead.csv")
+	var err error
+	if opts.deadLetter, err = createDeadLetter(path, opts.delimiter); err != nil {
+		t.Fatal(err)
+	}
+	bad := strings.Repeat("bm90IGFuIGltYWdl", 10)
+	if _, err := convertCSV(t, "bad,"+bad+"\n", opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.deadLetter.Close()
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "bad,"+bad+"\n" {
+		t.Errorf("expected the whole of the row in the dead letter file, got %q", contents)
+	}
+}
+
+func TestMaxOutputBytes(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.maxOutputBytes = 1000
+	large := base64.StdEncoding.EncodeToString(pngBytes(t, noiseImage(100, 100)))
+	stats, err := convertCSV(t, "small,"+pngData(t)+"\nlarge,"+large+"\n", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 1 || stats.tooLarge != 1 {
+		t.Fatalf("expected one image written and one too large, got %s", stats)
+	}
+	if images := outputImages(t, opts); len(images) != 1 || images[0] != "small.png" {
+		t.Errorf("expected only small.png to be written, got %v", images)
+	}
+
+	// The manifest's columns are id, row, result, format, file, bytes and error.
+	manifest := readManifest(t, opts)
+	if small := manifest["small"]; small[2] != "written" || small[5] == "" {
+		t.Errorf("expected the small image's size in the manifest, got %v", small)
+	}
+	if large := manifest["large"]; large[2] != "too_large" || large[5] == "" || large[6] == "" {
+		t.Errorf("expected the large image's size and the limit in the manifest, got %v", large)
+	}
+}
+
+func TestStrictFailsOnUndecodableRows(t *testing.T) {
+	contents := "good," + pngData(t) + "\nbad,bm90IGFuIGltYWdl\n"
+
+	opts := testOptions(t.TempDir())
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.dumped != 1 {
+		t.Fatalf("expected the bad row to be dumped without -strict, got %s", stats)
+	}
+	readOutput(t, opts, "bad.txt")
+
+	opts = testOptions(t.TempDir())
+	opts.strict = true
+	if stats, err = convertCSV(t, contents, opts); err != nil {
+		t.Fatal(err)
+	}
+	if stats.errors != 1 || stats.dumped != 0 {
+		t.Fatalf("expected the bad row to fail under -strict, got %s", stats)
+	}
+	if code := stats.exitCode(); code == exitOK {
+		t.Errorf("expected a nonzero exit status, got %d", code)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(opts.outputDir, "bad.txt")); err == nil {
+		t.Error("expected nothing to be dumped under -strict")
+	}
+}
+
+func TestJPEGDefaultQuality(t *testing.T) {
+	contents := "a," + base64.StdEncoding.EncodeToString(pngBytes(t, noiseImage(64, 64))) + "\n"
+	size := func(quality int) int {
+		opts := testOptions(t.TempDir())
+		opts.conv.Format = "jpeg"
+		opts.conv.JPEG.Quality = quality
+		if _, err := convertCSV(t, contents, opts); err != nil {
+			t.Fatal(err)
+		}
+		return len(readOutput(t, opts, "a.jpeg"))
+	}
+
+	if best, standard := size(100), size(jpeg.DefaultQuality); standard >= best {
+		t.Errorf("expected the default quality to be smaller than quality 100, got %d and %d bytes", standard, best)
+	}
+}
+
+func TestTrailingEmptyFields(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.formatColumn = "2"
+	opts.lenient = true
+	data := pngData(t)
+	contents := "a," + data + ",,,\nb," + data + ",jpeg,\nc,,,\n"
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 2 || stats.dumped != 1 {
+		t.Fatalf("expected two images written and the row without data dumped, got %s", stats)
+	}
+	if images := strings.Join(outputImages(t, opts), ","); images != "a.png,b.jpeg" {
+		t.Errorf("expected a.png and b.jpeg, got %s", images)
+	}
+}
+
+func TestTrailingEmptyFieldsBeforeColumnCount(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.formatColumn = "2"
+	opts.metaCols = []string{"all"}
+	var messages bytes.Buffer
+	opts.messages = &messages
+	data := pngData(t)
+	// Without -lenient, rows must have as many fields as the first, which only the
+	// second has until the trailing empty ones are dropped. The last has one too
+	// many even then.
+	contents := "a," + data + ",jpeg\nb," + data + ",,,,\nc," + data + "\nd," + data + ",png,x\n"
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 3 || stats.errors != 1 {
+		t.Fatalf("expected three images written and the last row rejected, got %s", stats)
+	}
+	if images := strings.Join(outputImages(t, opts), ","); images != "a.jpeg,b.png,c.png" {
+		t.Errorf("expected a.jpeg, b.png and c.png, got %s", images)
+	}
+	if meta := string(readOutput(t, opts, "b.json")); strings.Contains(meta, `"3"`) {
+		t.Errorf("expected no metadata from the trailing empty fields, got %s", meta)
+	}
+	if !strings.Contains(messages.String(), "Ignored trailing empty fields in 1 rows") {
+		t.Errorf("expected a note about the trimmed row, got %q", messages.String())
+	}
+}
+
+func TestTrailingEmptyFieldsWithHeader(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.header = true
+	opts.metaCols = []string{"caption"}
+	var messages bytes.Buffer
+	opts.messages = &messages
+	if _, err := convertCSV(t, "id,data,caption\na,"+pngData(t)+",\n", opts); err != nil {
+		t.Fatal(err)
+	}
+	if meta := string(readOutput(t, opts, "a.json")); !strings.Contains(meta, `"caption": ""`) {
+		t.Errorf("expected the empty caption in the sidecar, got %s", meta)
+	}
+	if strings.Contains(messages.String(), "trailing empty fields") {
+		t.Error("expected no notice about trailing empty fields")
+	}
+}
+
+func TestDuplicateHeaderNames(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.header = true
+	opts.metaCols = []string{"all"}
+	contents := "id,data,tag,caption,tag,caption,tag,,\na," + pngData(t) + ",x,y,z,w,v,,\n"
+	_, err := convertCSV(t, contents, opts)
+	want := "the header has more than one column with the same name: 'tag' (columns 2, 4 and 6), 'caption' (columns 3 and 5)"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected an error listing every duplicate name, got %v", err)
+	}
+	if images := outputImages(t, opts); len(images) != 0 {
+		t.Errorf("expected nothing to be converted, got %v", images)
+	}
+}
+
+func TestOutputDirIsAFile(t *testing.T) {
+	path := writeTemp(t, "output", "not a directory")
+	err := prepareOutputDir(path)
+	if err == nil || !strings.Contains(err.Error(), "already exists as a file") {
+		t.Fatalf("expected a clear error for an output directory that's a file, got %v", err)
+	}
+
+	sink := &csvimage.DirSink{Dir: path}
+	if err := sink.Write("a", "png", strings.NewReader("")); err == nil {
+		t.Error("expected writing into a file to fail")
+	}
+}
+
+func TestIgnoreDecodeErrorsWritesBin(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.ignoreDecodeErrors = true
+	blob := []byte("\x00\x01not an image\xff")
+	stats, err := convertCSV(t, "blob,"+base64.StdEncoding.EncodeToString(blob)+"\nbad,!!!\n", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.raw != 1 || stats.dumped != 1 {
+		t.Fatalf("expected one raw row and the invalid base-64 dumped, got %s", stats)
+	}
+	if got := readOutput(t, opts, "blob.bin"); !bytes.Equal(got, blob) {
+		t.Errorf("expected the decoded bytes %q, got %q", blob, got)
+	}
+	if result := readManifest(t, opts)["blob"][2]; result != "raw" {
+		t.Errorf("expected the row to be recorded as raw, got %s", result)
+	}
+}
+
+func TestCompressedDataWrittenUnchanged(t *testing.T) {
+	// Decompressed, neither is an image.
+	archive := compress(t, "an archive", "gzip")
+	blob := compress(t, "\x00\x01not an image\xff", "gzip")
+	contents := "archive," + base64.StdEncoding.EncodeToString([]byte(archive)) + ",application/gzip\n" +
+		"blob," + base64.StdEncoding.EncodeToString([]byte(blob)) + ",\n"
+
+	opts := testOptions(t.TempDir())
+	opts.mimeColumn = "2"
+	opts.ignoreDecodeErrors = true
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.raw != 2 {
+		t.Fatalf("expected both rows to be written as they are, got %s", stats)
+	}
+	if got := readOutput(t, opts, "archive.gz"); string(got) != archive {
+		t.Errorf("expected the gzipped data to be passed through still compressed, got %q", got)
+	}
+	if got := readOutput(t, opts, "blob.bin"); string(got) != blob {
+		t.Errorf("expected the gzipped data to be written still compressed, got %q", got)
+	}
+}
+
+// Converts a gzipped CSV with convertFile, with a single worker and with one per
+// CPU, which convert rows while the reader goes on decompressing and parsing.
+func BenchmarkConvertFile(b *testing.B) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(numberedCSV(b, 2000)))
+	w.Close()
+	path := writeTemp(b, "input.csv.gz", gz.String())
+
+	// Each row's outcome is printed to stdout, which would bury the results.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+
+	counts := []int{1}
+	if n := runtime.NumCPU(); n > 1 {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				opts := testOptions(b.TempDir())
+				opts.conv.Format = "jpeg"
+				opts.workers = workers
+				stats := newSummary()
+				if err := convertFile(context.Background(), path, opts, stats); err != nil {
+					b.Fatal(err)
+				}
+				if stats.success != 2000 {
+					b.Fatalf("expected 2000 images written, got %s", stats)
+				}
+			}
+		})
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.stripPrefix = "s3://bucket/photos/"
+	data := pngData(t)
+	contents := "s3://bucket/photos/a," + data + "\nb," + data + "\n"
+	if _, err := convertCSV(t, contents, opts); err != nil {
+		t.Fatal(err)
+	}
+	readOutput(t, opts, "a.png")
+	readOutput(t, opts, "b.png")
+
+	manifest := readManifest(t, opts)
+	if original := manifest["a"][7]; original != "s3://bucket/photos/a" {
+		t.Errorf("expected the manifest to keep the original identifier, got %q", original)
+	}
+	if original := manifest["b"][7]; original != "" {
+		t.Errorf("expected no original identifier when nothing was stripped, got %q", original)
+	}
+}
+
+func TestPNGPassThrough(t *testing.T) {
+	// Compressed differently than the encoder would, so re-encoding would show.
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := encoder.Encode(&buf, noiseImage(16, 16)); err != nil {
+		t.Fatal(err)
+	}
+	original := buf.Bytes()
+	contents := "a," + base64.StdEncoding.EncodeToString(original) + "\n"
+
+	for _, reencode := range []bool{false, true} {
+		opts := testOptions(t.TempDir())
+		opts.conv.Reencode = reencode
+		if _, err := convertCSV(t, contents, opts); err != nil {
+			t.Fatal(err)
+		}
+		if same := bytes.Equal(readOutput(t, opts, "a.png"), original); same == reencode {
+			t.Errorf("-reencode=%t: expected the original bytes to be written: %t", reencode, !reencode)
+		}
+	}
+}
+
+func TestOrderedRunsAreReproducible(t *testing.T) {
+	// Some undecodable rows, so the manifest has more than one kind of result.
+	contents := numberedCSV(t, 150) + "bad1,bm90IGFuIGltYWdl\nbad2,bm90IGFuIGltYWdl\n"
+
+	var manifests [][]byte
+	for run := 0; run < 2; run++ {
+		opts := testOptions(t.TempDir())
+		opts.ordered = true
+		opts.sample = 0.5
+		opts.seed = 42
+		opts.workers = 8
+		if _, err := convertCSV(t, contents, opts); err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, readOutput(t, opts, manifestName))
+	}
+	if !bytes.Equal(manifests[0], manifests[1]) {
+		t.Errorf("expected the manifests to be identical, got:\n%s\nand:\n%s", manifests[0], manifests[1])
+	}
+}
@@ -0,0 +1,200 @@
+// Package csvimage converts encoded image data, such as the base-64 strings found
+// in CSV exports, into image files. It's the library behind the csv-image command,
+// for Go programs that want to do the same without shelling out to it.
+package csvimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// A single image to convert: an identifier, which the command line tool uses as
+// the file name, and the encoded image data.
+type Record struct {
+	ID   string
+	Data string
+	// The format to write this image in, png or jpeg, overriding the converter's
+	// Format. Empty to use the converter's.
+	Format string
+	// The rest of the data, for data too long to hold in memory as a string, like
+	// a field spooled to disk as it was read. Data then holds only the start of it,
+	// and the whole is decoded as it's read (see NewStreamDecoder).
+	More io.Reader
+}
+
+// Decodes, transforms and re-encodes images. The zero value converts base-64 data,
+// writing each image in the format it was decoded from.
+type Converter struct {
+	// How image data is encoded: base64 (the default if empty), base32, ascii85, hex,
+	// or raw.
+	Encoding string
+	// The format to write every image in, png or jpeg. Empty to use the format each
+	// image was decoded from.
+	Format string
+	// Options for encoding JPEGs, or nil for the standard library's defaults.
+	JPEG *jpeg.Options
+	// Write Adam7-interlaced PNGs, which display progressively as they load.
+	Interlace bool
+	// Always re-encode images, rather than writing PNGs that need no transforms
+	// unchanged.
+	Reencode bool
+	// When the image decoder and the data's magic number disagree about an image's
+	// format, believe the magic number.
+	TrustMagic bool
+
+	// Transforms to apply before encoding, if not nil. See Transform.
+	Crop *image.Rectangle
+	Trim *Trim
+	Fit  *Fit
+}
+
+// Describes how a record was converted.
+type Result struct {
+	// The format the image decoder reported, or empty if the data couldn't be
+	// decoded.
+	Detected string
+	// The format the magic number at the start of the decoded data suggests, or
+	// empty if it isn't one we know.
+	Magic string
+	// The media type the data declared, if it was given as a data URI, like
+	// image/png.
+	DataURIType string
+	// The dimensions of the decoded image, before any transforms.
+	Width  int
+	Height int
+	// The format the image was written in.
+	Format string
+	// Whether the decoded data was written unchanged, without re-encoding it.
+	PassedThrough bool
+
+	// The size of the image written by Run, in bytes.
+	Bytes int
+	// Why Run couldn't convert or write the record, if it couldn't. Convert returns
+	// its errors separately instead.
+	Err error
+}
+
+// Returned when a record's data can't be decoded as an image.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Returned when an image would have to be written in a format that can't be
+// encoded, because it was decoded from one and no other was requested.
+type FormatError struct {
+	Format string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("unrecognized image format: %s", e.Format)
+}
+
+// Returns the canonical name of an output format we can encode, and whether it
+// is one.
+func NormalizeFormat(value string) (string, bool) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "png", "jpeg":
+		return value, true
+	case "jpg":
+		return "jpeg", true
+	default:
+		return "", false
+	}
+}
+
+// Decodes a record's image data, applies any transforms, and writes the encoded
+// image to `w`. Errors from decoding the data are *DecodeErrors, and an image that
+// can't be written in the format it was decoded from is a *FormatError. The result
+// describes as much of the conversion as happened, even when there's an error.
+func (c *Converter) Convert(rec Record, w io.Writer) (Result, error) {
+	res := Result{DataURIType: DataURIType(rec.Data)}
+
+	// Keep the decoded bytes, so their magic number can be checked against the
+	// format the image decoder reports, and so they can be written unchanged when
+	// there's no need to re-encode them.
+	decoder, size := NewDecoder(rec.Data, c.Encoding), len(rec.Data)
+	if rec.More != nil {
+		decoder, size = NewStreamDecoder(io.MultiReader(strings.NewReader(rec.Data), rec.More), c.Encoding), 0
+	}
+	decoded, err := readAll(decoder, size)
+	res.Magic = SniffMagic(decoded)
+	if err != nil {
+		return res, &DecodeError{err}
+	}
+
+	img, detected, err := image.Decode(bytes.NewReader(decoded))
+	res.Detected = detected
+	if err != nil {
+		return res, &DecodeError{err}
+	}
+	res.Width, res.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	if c.TrustMagic && res.Magic != "" {
+		detected = res.Magic
+	}
+
+	res.Format = rec.Format
+	if res.Format == "" {
+		res.Format = c.Format
+	}
+	if res.Format == "" {
+		res.Format = detected
+	}
+
+	// A PNG that's written as a PNG without any transforms would come out of
+	// re-encoding with the same pixels, so write the original bytes instead. This
+	// saves time and keeps the encoder's compression choices.
+	if res.Format == "png" && detected == "png" && !c.HasTransforms() && !c.Reencode && !c.Interlace {
+		res.PassedThrough = true
+		_, err = w.Write(decoded)
+		return res, err
+	}
+
+	if _, ok := NormalizeFormat(res.Format); !ok {
+		return res, &FormatError{res.Format}
+	}
+	return res, c.Encode(w, c.Transform(img), res.Format)
+}
+
+// Reads all of the decoded data from `r`, making room for `size` bytes up front.
+// Encoded data is never shorter than what it decodes to, unless it was compressed,
+// so its length saves growing the buffer bit by bit, which for images tens of
+// megabytes in size would copy them many times over.
+func readAll(r io.Reader, size int) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+// Decodes image data, returning the image and the format the decoder reports.
+func (c *Converter) Decode(data string) (image.Image, string, error) {
+	return image.Decode(NewDecoder(data, c.Encoding))
+}
+
+// Encodes an image as a PNG or JPEG.
+func (c *Converter) Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "png":
+		if c.Interlace {
+			return encodeInterlacedPNG(w, img)
+		}
+		return png.Encode(w, img)
+	case "jpeg":
+		return jpeg.Encode(w, img, c.JPEG)
+	default:
+		return &FormatError{format}
+	}
+}
@@ -0,0 +1,51 @@
+package csvimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// Returns a `w` by `h` image filled with `c`.
+func solidImage(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// Returns an image encoded as a PNG.
+func encodePNG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Converts `img`, given as a base-64 PNG, with `conv`, and decodes the result.
+func convertImage(t testing.TB, conv *Converter, img image.Image) (image.Image, Result) {
+	t.Helper()
+	var out bytes.Buffer
+	res, err := conv.Convert(Record{ID: "test", Data: base64.StdEncoding.EncodeToString(encodePNG(t, img))}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, _, err := image.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return converted, res
+}
+
+// Reports whether two colors are the same once converted to 8-bit RGBA.
+func sameColor(a, b color.Color) bool {
+	return color.NRGBAModel.Convert(a) == color.NRGBAModel.Convert(b)
+}
@@ -0,0 +1,279 @@
+package csvimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Text encodings that image data in a CSV may use.
+var Encodings = []string{"base64", "base32", "ascii85", "hex", "raw"}
+
+// Returns a reader of the binary data encoded in some text.
+type Decoder func(data string) io.Reader
+
+// The decoder for each of the Encodings.
+var decoders = map[string]Decoder{
+	"base64":  newBase64OrHexDecoder,
+	"base32":  newBase32Decoder,
+	"ascii85": newASCII85Decoder,
+	"hex":     newHexDecoder,
+	"raw":     newRawDecoder,
+}
+
+// Checks that `encoding` is one of the supported encodings.
+func ValidateEncoding(encoding string) error {
+	_, err := DecoderFor(encoding)
+	return err
+}
+
+// Returns the decoder for one of the Encodings, so that it can be chosen once for
+// a whole run. An empty encoding means base-64. Data given as a data URI, like
+// 'data:image/png;base64,iVBOR...', is decoded according to the URI whatever the
+// encoding. Images that were compressed with gzip or zlib before being encoded
+// are decompressed.
+func DecoderFor(encoding string) (Decoder, error) {
+	if encoding == "" {
+		encoding = "base64"
+	}
+	decode, ok := decoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding '%s': must be one of %s", encoding, strings.Join(Encodings, ", "))
+	}
+
+	return func(data string) io.Reader {
+		return decompressPayload(decodeText(data, decode))
+	}, nil
+}
+
+// Decodes `data` with `decode`, or according to the URI if it's a data URI.
+func decodeText(data string, decode Decoder) io.Reader {
+	if r, ok := newDataURIDecoder(data); ok {
+		return r
+	}
+	return decode(data)
+}
+
+// Returns a reader of the data from `r`, decompressed if it starts with a gzip or
+// zlib header. Neither can be mistaken for the start of an image.
+func decompressPayload(r io.Reader) io.Reader {
+	// Put the header back in front of the rest, rather than peeking at it through a
+	// bufio.Reader, which would copy all of the data once more.
+	var header [2]byte
+	n, err := io.ReadFull(r, header[:])
+	r = io.MultiReader(bytes.NewReader(header[:n]), r)
+	if err != nil {
+		// Too short to be compressed, or an error that reading on will return again.
+		return r
+	}
+
+	var zr io.Reader
+	switch {
+	case header[0] == 0x1f && header[1] == 0x8b:
+		zr, err = gzip.NewReader(r)
+	case header[0]&0x0f == 8 && (int(header[0])<<8|int(header[1]))%31 == 0:
+		// A zlib header: the deflate method, and a checksum of the two bytes.
+		zr, err = zlib.NewReader(r)
+	default:
+		return r
+	}
+	if err != nil {
+		return &errReader{err}
+	}
+	return zr
+}
+
+// A reader that fails with the same error every time.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// Returns a reader of the binary image data encoded in `data`, using the decoder
+// for `encoding` (see DecoderFor), or base-64 if it isn't one of the Encodings.
+func NewDecoder(data, encoding string) io.Reader {
+	decode, err := DecoderFor(encoding)
+	if err != nil {
+		decode, _ = DecoderFor("base64")
+	}
+	return decode(data)
+}
+
+// Like NewDecoder, but leaves data that was compressed before it was encoded as it
+// is, for writing the decoded bytes out unchanged.
+func NewVerbatimDecoder(data, encoding string) io.Reader {
+	if encoding == "" {
+		encoding = "base64"
+	}
+	decode, ok := decoders[encoding]
+	if !ok {
+		decode = decoders["base64"]
+	}
+	return decodeText(data, decode)
+}
+
+// Decodes a data URI, reporting whether `data` was one.
+func newDataURIDecoder(data string) (io.Reader, bool) {
+	_, payload, isBase64, ok := parseDataURI(data)
+	if !ok {
+		return nil, false
+	}
+	if isBase64 {
+		return newBase64Decoder(payload), true
+	}
+	if unescaped, err := url.PathUnescape(payload); err == nil {
+		payload = unescaped
+	}
+	return strings.NewReader(payload), true
+}
+
+// Decodes base-64, which may be standard or URL-safe, padded or not, except that
+// data starting with '\x', as Postgres dumps bytea columns, is taken to be hex,
+// since that can't be base-64.
+func newBase64OrHexDecoder(data string) io.Reader {
+	if strings.HasPrefix(data, `\x`) {
+		return newHexDecoder(data)
+	}
+	return newBase64Decoder(data)
+}
+
+// Decodes base-32, padded or not.
+func newBase32Decoder(data string) io.Reader {
+	data = removeWhitespace(data)
+	encoding := base32.StdEncoding
+	if !strings.HasSuffix(data, "=") && len(data)%8 != 0 {
+		encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+	}
+	return base32.NewDecoder(encoding, strings.NewReader(data))
+}
+
+func newASCII85Decoder(data string) io.Reader {
+	// Adobe-style ASCII85 wraps the data in '<~' and '~>', which the decoder
+	// doesn't understand.
+	data = strings.TrimSpace(data)
+	data = strings.TrimSuffix(strings.TrimPrefix(data, "<~"), "~>")
+	return ascii85.NewDecoder(strings.NewReader(data))
+}
+
+func newRawDecoder(data string) io.Reader {
+	// Raw bytes must be quoted in the CSV. Note that csv.Reader drops any '\r'
+	// that precedes a '\n', even inside quotes, so this only works for data that
+	// never contains that sequence.
+	return strings.NewReader(data)
+}
+
+// Decodes hex, which may be prefixed with '\x' or '0x'.
+func newHexDecoder(data string) io.Reader {
+	data = removeWhitespace(data)
+	if strings.HasPrefix(data, `\x`) || strings.HasPrefix(data, "0x") {
+		data = data[2:]
+	}
+	return hex.NewDecoder(strings.NewReader(data))
+}
+
+func newBase64Decoder(data string) io.Reader {
+	data = removeWhitespace(data)
+	return base64.NewDecoder(base64Variant(data), strings.NewReader(data))
+}
+
+// Removes whitespace from data, such as the line breaks of MIME-wrapped base-64,
+// which has no meaning in text encodings of binary data. Data without any is
+// returned as it is, without copying it.
+func removeWhitespace(data string) string {
+	if !containsAnyByte(data, " \t\r\n") {
+		return data
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, data)
+}
+
+// Like strings.ContainsAny for ASCII characters, but much faster for the tens of
+// megabytes that image data can run to, since strings.IndexByte is vectorized.
+func containsAnyByte(s, chars string) bool {
+	for i := 0; i < len(chars); i++ {
+		if strings.IndexByte(s, chars[i]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the variant of base-64 that `data`, without whitespace, appears to be
+// encoded with: URL-safe if it has either of the characters only that alphabet
+// uses, and unpadded if it has no padding despite needing some.
+func base64Variant(data string) *base64.Encoding {
+	urlSafe := containsAnyByte(data, "-_")
+	padded := strings.HasSuffix(data, "=") || len(data)%4 == 0
+
+	switch {
+	case urlSafe && padded:
+		return base64.URLEncoding
+	case urlSafe:
+		return base64.RawURLEncoding
+	case padded:
+		return base64.StdEncoding
+	default:
+		return base64.RawStdEncoding
+	}
+}
+
+// Returns the media type of image data given as a data URI, like image/png, or an
+// empty string if it isn't one or doesn't say.
+func DataURIType(data string) string {
+	mediaType, _, _, _ := parseDataURI(data)
+	return mediaType
+}
+
+// Splits a data URI of the form 'data:[<media type>][;base64],<data>' into its
+// media type and data, reporting whether the data is base-64 and whether it was a
+// data URI at all. Parameters of the media type, like a charset, are dropped.
+func parseDataURI(uri string) (mediaType, payload string, isBase64, ok bool) {
+	uri = strings.TrimSpace(uri)
+	if len(uri) < 5 || !strings.EqualFold(uri[:5], "data:") {
+		return "", "", false, false
+	}
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return "", "", false, false
+	}
+
+	params := strings.Split(uri[5:comma], ";")
+	if last := len(params) - 1; strings.EqualFold(params[last], "base64") {
+		isBase64 = true
+		params = params[:last]
+	}
+	return strings.ToLower(strings.TrimSpace(params[0])), uri[comma+1:], isBase64, true
+}
+
+// Encodes binary image data as text, the inverse of NewDecoder.
+func EncodeData(b []byte, encoding string) string {
+	switch encoding {
+	case "ascii85":
+		buf := make([]byte, ascii85.MaxEncodedLen(len(b)))
+		return string(buf[:ascii85.Encode(buf, b)])
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base32":
+		return base32.StdEncoding.EncodeToString(b)
+	case "raw":
+		return string(b)
+	default:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+}
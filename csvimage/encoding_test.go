@@ -0,0 +1,69 @@
+package csvimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/ascii85"
+	"encoding/base64"
+	"image/color"
+	"io/ioutil"
+	"testing"
+)
+
+func TestASCII85(t *testing.T) {
+	original := encodePNG(t, solidImage(3, 2, color.White))
+	buf := make([]byte, ascii85.MaxEncodedLen(len(original)))
+	encoded := string(buf[:ascii85.Encode(buf, original)])
+
+	for _, data := range []string{encoded, "<~" + encoded + "~>", " <~" + encoded + "~>\n"} {
+		decoded, err := ioutil.ReadAll(NewDecoder(data, "ascii85"))
+		if err != nil {
+			t.Fatalf("%q: %s", data, err)
+		}
+		if !bytes.Equal(decoded, original) {
+			t.Errorf("%q decoded to the wrong bytes", data)
+		}
+	}
+
+	var out bytes.Buffer
+	res, err := (&Converter{Encoding: "ascii85"}).Convert(Record{ID: "a", Data: "<~" + encoded + "~>"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Detected != "png" || res.Width != 3 || res.Height != 2 {
+		t.Errorf("expected a 3x2 png, got %s %dx%d", res.Detected, res.Width, res.Height)
+	}
+}
+
+func TestRawEncoding(t *testing.T) {
+	original := encodePNG(t, solidImage(3, 2, color.White))
+	var out bytes.Buffer
+	res, err := (&Converter{Encoding: "raw"}).Convert(Record{ID: "a", Data: string(original)}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Detected != "png" || !bytes.Equal(out.Bytes(), original) {
+		t.Errorf("expected the raw png to come through unchanged, got %s", res.Detected)
+	}
+}
+
+func TestVerbatimDecoder(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("payload"))
+	w.Close()
+	data := base64.StdEncoding.EncodeToString(compressed.Bytes())
+
+	for _, encoded := range []string{data, "data:application/gzip;base64," + data} {
+		decoded, err := ioutil.ReadAll(NewVerbatimDecoder(encoded, "base64"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, compressed.Bytes()) {
+			t.Errorf("%.30s: expected the gzipped bytes, got %q", encoded, decoded)
+		}
+		if decompressed, _ := ioutil.ReadAll(NewDecoder(encoded, "base64")); string(decompressed) != "payload" {
+			t.Errorf("%.30s: expected NewDecoder to decompress, got %q", encoded, decompressed)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package csvimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// The Adam7 passes of an interlaced PNG: where each starts, and how far apart its
+// pixels are.
+var adam7 = []struct{ x, y, dx, dy int }{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// Encodes an image as an Adam7-interlaced, 8-bit RGBA PNG, which image/png can't
+// produce. Interlaced PNGs can be displayed at low resolution before they've
+// finished downloading.
+func encodeInterlacedPNG(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	src, ok := img.(*image.NRGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	width, height := b.Dx(), b.Dy()
+
+	var pixels bytes.Buffer
+	zw := zlib.NewWriter(&pixels)
+	for _, pass := range adam7 {
+		passWidth := (width - pass.x + pass.dx - 1) / pass.dx
+		passHeight := (height - pass.y + pass.dy - 1) / pass.dy
+		if passWidth <= 0 || passHeight <= 0 {
+			continue
+		}
+
+		prev := make([]byte, 4*passWidth)
+		row := make([]byte, 4*passWidth)
+		for py := 0; py < passHeight; py++ {
+			y := pass.y + py*pass.dy
+			for px := 0; px < passWidth; px++ {
+				i := src.PixOffset(pass.x+px*pass.dx, y)
+				copy(row[4*px:4*px+4], src.Pix[i:i+4])
+			}
+			if _, err := zw.Write(filterRow(row, prev)); err != nil {
+				return err
+			}
+			prev, row = row, prev
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(height))
+	header[8] = 8  // Bit depth
+	header[9] = 6  // Color type: RGBA
+	header[12] = 1 // Interlace method: Adam7
+
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+	for _, chunk := range []struct {
+		name string
+		data []byte
+	}{
+		{"IHDR", header},
+		{"IDAT", pixels.Bytes()},
+		{"IEND", nil},
+	} {
+		if err := writeChunk(w, chunk.name, chunk.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a row of 4-byte pixels prefixed with its filter type, choosing whichever
+// of the Sub, Up and Paeth filters (or none) is likely to compress best.
+func filterRow(row, prev []byte) []byte {
+	best, bestScore := []byte(nil), -1
+	for filter := byte(0); filter <= 4; filter++ {
+		if filter == 3 {
+			// Skip the Average filter, which rarely beats Paeth.
+			continue
+		}
+
+		filtered := make([]byte, len(row)+1)
+		filtered[0] = filter
+		score := 0
+		for i, x := range row {
+			var a, b, c byte
+			if i >= 4 {
+				a, c = row[i-4], prev[i-4]
+			}
+			b = prev[i]
+
+			var v byte
+			switch filter {
+			case 0:
+				v = x
+			case 1:
+				v = x - a
+			case 2:
+				v = x - b
+			case 4:
+				v = x - paeth(a, b, c)
+			}
+			filtered[i+1] = v
+			score += abs(int(int8(v)))
+		}
+
+		if bestScore < 0 || score < bestScore {
+			best, bestScore = filtered, score
+		}
+	}
+	return best
+}
+
+// The Paeth predictor from the PNG specification.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Writes a PNG chunk: its length, name, data and CRC.
+func writeChunk(w io.Writer, name string, data []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+
+	crc := crc32.NewIEEE()
+	io.WriteString(crc, name)
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+
+	for _, part := range [][]byte{length[:], []byte(name), data, sum[:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package csvimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// Returns a `w` by `h` image whose pixels all differ, so a pixel written to the
+// wrong place shows.
+func gradientImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 16), uint8(y * 16), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func TestInterlace(t *testing.T) {
+	// Sizes that leave some Adam7 passes partial or empty.
+	for _, size := range []image.Point{{1, 1}, {3, 2}, {13, 11}} {
+		src := gradientImage(size.X, size.Y)
+		conv := &Converter{Encoding: "base64", Interlace: true}
+		var out bytes.Buffer
+		if _, err := conv.Convert(Record{ID: "test", Data: base64.StdEncoding.EncodeToString(encodePNG(t, src))}, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		// The IHDR chunk follows the 8-byte signature and its own length and type,
+		// and its last byte is the interlace method.
+		encoded := out.Bytes()
+		if len(encoded) < 29 || string(encoded[12:16]) != "IHDR" {
+			t.Fatalf("%v: expected an IHDR chunk first", size)
+		}
+		if method := encoded[28]; method != 1 {
+			t.Errorf("%v: expected interlace method 1, got %d", size, method)
+		}
+
+		img, err := png.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("%v: %s", size, err)
+		}
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				if !sameColor(img.At(x, y), src.At(x, y)) {
+					t.Fatalf("%v: pixel (%d, %d) is %v, expected %v", size, x, y, img.At(x, y), src.At(x, y))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package csvimage
+
+import "bytes"
+
+// Magic numbers at the start of common file formats, for diagnosing data that
+// couldn't be decoded as an image.
+var magicNumbers = []struct {
+	format string
+	prefix []byte
+}{
+	{"png", []byte("\x89PNG\r\n\x1a\n")},
+	{"jpeg", []byte{0xff, 0xd8, 0xff}},
+	{"gif", []byte("GIF8")},
+	{"bmp", []byte("BM")},
+	{"tiff", []byte("II*\x00")},
+	{"tiff", []byte("MM\x00*")},
+	{"pdf", []byte("%PDF")},
+	{"zip", []byte("PK\x03\x04")},
+	{"gzip", []byte{0x1f, 0x8b}},
+}
+
+// Returns the format suggested by the magic number at the start of `b`, or an
+// empty string if it isn't one we know.
+func SniffMagic(b []byte) string {
+	// WebP is a RIFF container, with the format identifier after the file size.
+	if len(b) >= 12 && bytes.HasPrefix(b, []byte("RIFF")) && string(b[8:12]) == "WEBP" {
+		return "webp"
+	}
+	for _, m := range magicNumbers {
+		if bytes.HasPrefix(b, m.prefix) {
+			return m.format
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package csvimage
+
+import (
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// A format the image decoder recognizes by a bitmap's magic number, so the two
+// disagree about data starting with it.
+func init() {
+	decode := func(r io.Reader) (image.Image, error) {
+		if _, err := ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+		return solidImage(1, 1, color.White), nil
+	}
+	decodeConfig := func(r io.Reader) (image.Config, error) {
+		return image.Config{ColorModel: color.NRGBAModel, Width: 1, Height: 1}, nil
+	}
+	image.RegisterFormat("crafted", "BM", decode, decodeConfig)
+}
+
+func TestTrustMagic(t *testing.T) {
+	data := base64.StdEncoding.EncodeToString([]byte("BMcrafted"))
+	tests := []struct {
+		trustMagic bool
+		expected   string
+	}{
+		{false, "crafted"},
+		{true, "bmp"},
+	}
+
+	for _, test := range tests {
+		conv := &Converter{Encoding: "base64", TrustMagic: test.trustMagic}
+		res, err := conv.Convert(Record{ID: "test", Data: data}, ioutil.Discard)
+		if res.Detected != "crafted" || res.Magic != "bmp" {
+			t.Fatalf("expected the decoder and magic number to disagree, got %q and %q", res.Detected, res.Magic)
+		}
+		if res.Format != test.expected {
+			t.Errorf("TrustMagic=%t: expected format %q, got %q", test.trustMagic, test.expected, res.Format)
+		}
+		var formatErr *FormatError
+		if !errors.As(err, &formatErr) || formatErr.Format != test.expected {
+			t.Errorf("TrustMagic=%t: expected a FormatError for %q, got %v", test.trustMagic, test.expected, err)
+		}
+	}
+}
+
+func TestTrustMagicWhenFormatsAgree(t *testing.T) {
+	for _, trustMagic := range []bool{false, true} {
+		_, res := convertImage(t, &Converter{Encoding: "base64", TrustMagic: trustMagic}, solidImage(2, 2, color.Black))
+		if res.Format != "png" {
+			t.Errorf("TrustMagic=%t: expected png, got %q", trustMagic, res.Format)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package csvimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Configures Run.
+type Option func(*runConfig)
+
+type runConfig struct {
+	converter   Converter
+	concurrency int
+	onRecord    func(id string, result Result)
+	handler     func(n int, rec Record) Result
+}
+
+// Sets how many records are converted at once. Defaults to one per CPU.
+func WithConcurrency(n int) Option {
+	return func(c *runConfig) {
+		c.concurrency = n
+	}
+}
+
+// Sets the format to write every image in, png or jpeg. By default each image is
+// written in the format it was decoded from.
+func WithFormat(format string) Option {
+	return func(c *runConfig) {
+		c.converter.Format = format
+	}
+}
+
+// Sets the quality (1-100) of JPEGs. Defaults to the standard library's default.
+func WithQuality(quality int) Option {
+	return func(c *runConfig) {
+		c.converter.JPEG = &jpeg.Options{Quality: quality}
+	}
+}
+
+// Calls `fn` with the outcome of each record once it's been converted and written,
+// or has failed, for progress reporting or collecting errors. It's called from
+// several goroutines at once, unless the concurrency is 1.
+func WithOnRecord(fn func(id string, result Result)) Option {
+	return func(c *runConfig) {
+		c.onRecord = fn
+	}
+}
+
+// Handles each record with `fn` in place of converting it and writing it to the
+// sink, for callers that do more with a record than that, like the csv-image
+// command, which dumps data that can't be decoded. Run still reads the records
+// and hands them out to be handled concurrently, and `n` counts them from 0 in the
+// order they were read, telling apart records with the same ID. A result with an
+// Err counts as a failure, as the converter's errors do.
+func WithHandler(fn func(n int, rec Record) Result) Option {
+	return func(c *runConfig) {
+		c.handler = fn
+	}
+}
+
+// Converts with a copy of `conv`, for settings that have no option of their own.
+// Options after this one apply on top of it.
+func WithConverter(conv *Converter) Option {
+	return func(c *runConfig) {
+		c.converter = *conv
+	}
+}
+
+// Converts every record from `src`, writing the images to `sink`, until the source
+// is exhausted or `ctx` is cancelled. A record that can't be converted or written
+// doesn't stop the others, and neither does a CSV row without a data column; the
+// error returned describes the first of them, along with how many there were.
+// Any other error reading from the source stops the run.
+func Run(ctx context.Context, src RecordSource, sink ImageSink, opts ...Option) error {
+	config := runConfig{concurrency: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", config.concurrency)
+	}
+	handle := config.handler
+	if handle == nil {
+		conv := &config.converter
+		// Each image is encoded into a buffer before being written, and the
+		// buffers are reused from one record to the next.
+		bufs := sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+		handle = func(n int, rec Record) Result {
+			buf := bufs.Get().(*bytes.Buffer)
+			defer bufs.Put(buf)
+			buf.Reset()
+			res, err := conv.Convert(rec, buf)
+			if err == nil {
+				res.Bytes = buf.Len()
+				err = sink.Write(rec.ID, res.Format, buf)
+			}
+			res.Err = err
+			return res
+		}
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	failures, total := 0, 0
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		failures++
+	}
+
+	// Records are read here and handed to a fixed pool of workers through a
+	// buffered channel, so that reading overlaps with converting. When the workers
+	// fall behind, the full channel holds reading back.
+	type numbered struct {
+		n   int
+		rec Record
+	}
+	records := make(chan numbered, 2*config.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < config.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range records {
+				res := handle(r.n, r.rec)
+				if res.Err != nil {
+					fail(fmt.Errorf("%s: %w", r.rec.ID, res.Err))
+				}
+				if config.onRecord != nil {
+					config.onRecord(r.rec.ID, res)
+				}
+			}
+		}()
+	}
+
+	var srcErr error
+	n := 0
+	for ctx.Err() == nil {
+		id, data, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		var short *ShortRowError
+		if errors.As(err, &short) {
+			total++
+			fail(err)
+			if config.onRecord != nil {
+				config.onRecord(id, Result{Err: err})
+			}
+			continue
+		}
+		if err != nil {
+			srcErr = err
+			break
+		}
+		total++
+		records <- numbered{n: n, rec: Record{ID: id, Data: data}}
+		n++
+	}
+	close(records)
+	wg.Wait()
+
+	switch {
+	case srcErr != nil:
+		return srcErr
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case firstErr != nil:
+		return fmt.Errorf("failed to convert %d of %d records, starting with %w", failures, total, firstErr)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package csvimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// An image sink that keeps what's written to it in memory.
+type memorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *memorySink) Write(id, format string, r io.Reader) error {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = map[string][]byte{}
+	}
+	s.files[id+"."+format] = contents
+	return nil
+}
+
+// Returns a source of CSV rows, which may have any number of fields.
+func csvSource(contents string) *CSVSource {
+	r := csv.NewReader(strings.NewReader(contents))
+	r.FieldsPerRecord = -1
+	return NewCSVSource(r)
+}
+
+// Returns a base-64 PNG of a noisy image, which compresses differently at different
+// JPEG qualities.
+func noisyPNG(t testing.TB) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251)
+	}
+	return base64.StdEncoding.EncodeToString(encodePNG(t, img))
+}
+
+func TestRun(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString(encodePNG(t, solidImage(4, 3, color.White)))
+	src := csvSource("a," + png + "\nbad,bm90IGFuIGltYWdl\nshort\nb," + png + "\n")
+	sink := &memorySink{}
+
+	var mu sync.Mutex
+	results := map[string]Result{}
+	onRecord := func(id string, res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[id] = res
+	}
+
+	err := Run(context.Background(), src, sink, WithConcurrency(2), WithOnRecord(onRecord))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to convert 2 of 4 records") {
+		t.Fatalf("expected the bad and short rows to be reported, got %v", err)
+	}
+
+	if len(sink.files) != 2 || sink.files["a.png"] == nil || sink.files["b.png"] == nil {
+		t.Errorf("expected a.png and b.png to be written, got %d files", len(sink.files))
+	}
+	if res := results["a"]; res.Err != nil || res.Format != "png" || res.Width != 4 || res.Height != 3 || res.Bytes != len(sink.files["a.png"]) {
+		t.Errorf("unexpected result for a: %+v", res)
+	}
+	var decodeErr *DecodeError
+	if !errors.As(results["bad"].Err, &decodeErr) {
+		t.Errorf("expected a DecodeError for bad, got %v", results["bad"].Err)
+	}
+	var short *ShortRowError
+	if !errors.As(results[""].Err, &short) || short.Row != 3 {
+		t.Errorf("expected a ShortRowError for row 3, got %v", results[""].Err)
+	}
+}
+
+func TestRunWithFormatAndQuality(t *testing.T) {
+	src := "a," + noisyPNG(t) + "\n"
+	convert := func(opts ...Option) []byte {
+		t.Helper()
+		sink := &memorySink{}
+		if err := Run(context.Background(), csvSource(src), sink, opts...); err != nil {
+			t.Fatal(err)
+		}
+		jpeg, ok := sink.files["a.jpeg"]
+		if !ok {
+			t.Fatal("expected a.jpeg to be written")
+		}
+		return jpeg
+	}
+
+	low := convert(WithFormat("jpeg"), WithQuality(10))
+	high := convert(WithFormat("jpeg"), WithQuality(100))
+	if len(low) >= len(high) {
+		t.Errorf("expected quality 10 to be smaller than quality 100, got %d and %d bytes", len(low), len(high))
+	}
+
+	// Options after WithConverter apply on top of it.
+	layered := convert(WithConverter(&Converter{Format: "jpeg"}), WithQuality(10))
+	if !bytes.Equal(layered, low) {
+		t.Error("expected WithQuality after WithConverter to apply")
+	}
+}
+
+func TestRunWithConverter(t *testing.T) {
+	sink := &memorySink{}
+	conv := &Converter{Format: "png", Crop: &image.Rectangle{Max: image.Pt(2, 1)}}
+	png := base64.StdEncoding.EncodeToString(encodePNG(t, solidImage(4, 3, color.White)))
+	if err := Run(context.Background(), csvSource("a,"+png+"\n"), sink, WithConverter(conv)); err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(sink.files["a.png"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(2, 1) {
+		t.Errorf("expected the converter's crop to apply, got %v", size)
+	}
+}
+
+func TestRunRejectsZeroConcurrency(t *testing.T) {
+	if err := Run(context.Background(), csvSource(""), &memorySink{}, WithConcurrency(0)); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink := &memorySink{}
+	png := base64.StdEncoding.EncodeToString(encodePNG(t, solidImage(1, 1, color.White)))
+	if err := Run(ctx, csvSource("a,"+png+"\n"), sink); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(sink.files) != 0 {
+		t.Errorf("expected nothing to be written, got %d files", len(sink.files))
+	}
+}
+
+func TestRunStopsOnSourceError(t *testing.T) {
+	src := csvSource("a,\"unterminated\"x\n")
+	err := Run(context.Background(), src, &memorySink{})
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected the parse error to stop the run, got %v", err)
+	}
+}
+
+func TestRunWithHandler(t *testing.T) {
+	src := csvSource("a,1\nb,2\na,3\n")
+	var mu sync.Mutex
+	handled := map[int]Record{}
+	var results []string
+	err := Run(context.Background(), src, &memorySink{},
+		WithConcurrency(2),
+		WithHandler(func(n int, rec Record) Result {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[n] = rec
+			if rec.Data == "2" {
+				return Result{Err: errors.New("refused")}
+			}
+			return Result{Format: "png"}
+		}),
+		WithOnRecord(func(id string, result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, id+":"+result.Format)
+		}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "failed to convert 1 of 3 records, starting with b: refused") {
+		t.Errorf("expected the handler's failure to be reported, got %v", err)
+	}
+
+	// Records are numbered in the order they're read, telling apart those with the
+	// same ID.
+	for n, want := range []string{"a,1", "b,2", "a,3"} {
+		if rec := handled[n]; rec.ID+","+rec.Data != want {
+			t.Errorf("expected record %d to be %s, got %s,%s", n, want, rec.ID, rec.Data)
+		}
+	}
+	if len(results) != 3 {
+		t.Errorf("expected the callback to be called for every record, got %v", results)
+	}
+}
@@ -0,0 +1,83 @@
+package csvimage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Somewhere to put converted images, such as a directory. The format doubles as
+// the kind of file being written, so a sink may also be handed other files about
+// a record, like 'bin' for data that isn't an image or 'json' for metadata.
+type ImageSink interface {
+	Write(id, format string, r io.Reader) error
+}
+
+// Writes images to files named '<id>.<format>' in a directory, which is created
+// if it doesn't exist. An id containing slashes names a file in a subdirectory,
+// which is created too, but one that's absolute or climbs out of the directory,
+// like '../x', is refused.
+type DirSink struct {
+	Dir string
+}
+
+// Returns the path of the file an image is written to.
+func (s *DirSink) Path(id, format string) string {
+	return filepath.Join(s.Dir, id+"."+format)
+}
+
+// Returns the path of the file an image is written to, or an error if it would be
+// outside the directory.
+func (s *DirSink) checkedPath(id, format string) (string, error) {
+	name := filepath.FromSlash(id + "." + format)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("identifier '%s' is an absolute path, which would be written outside '%s'", id, s.Dir)
+	}
+	if clean := filepath.Clean(name); clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("identifier '%s' would be written outside '%s'", id, s.Dir)
+	}
+	return s.Path(id, format), nil
+}
+
+// Reports whether the file for an image already exists.
+func (s *DirSink) Exists(id, format string) bool {
+	path, err := s.checkedPath(id, format)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Creates or replaces the file for an image. The image is written to a '.partial'
+// file that's renamed into place once complete, so that a process that's killed
+// part way through never leaves a truncated image behind.
+func (s *DirSink) Write(id, format string, r io.Reader) error {
+	path, err := s.checkedPath(id, format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	partial := path + ".partial"
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+	}
+	return err
+}
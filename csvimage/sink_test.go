@@ -0,0 +1,56 @@
+package csvimage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirSinkWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "output")
+	sink := &DirSink{Dir: dir}
+
+	for _, id := range []string{"a", "nested/b", "nested/../c"} {
+		if err := sink.Write(id, "png", strings.NewReader(id)); err != nil {
+			t.Fatalf("failed to write '%s': %s", id, err)
+		}
+		contents, err := ioutil.ReadFile(sink.Path(id, "png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != id {
+			t.Errorf("expected '%s' to hold %q, got %q", sink.Path(id, "png"), id, contents)
+		}
+		if !sink.Exists(id, "png") {
+			t.Errorf("expected '%s' to exist", id)
+		}
+	}
+	if path := sink.Path("nested/../c", "png"); path != filepath.Join(dir, "c.png") {
+		t.Errorf("expected 'nested/../c' to be written to '%s', got '%s'", filepath.Join(dir, "c.png"), path)
+	}
+}
+
+func TestDirSinkRejectsPathsOutsideDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "output")
+	sink := &DirSink{Dir: dir}
+
+	for _, id := range []string{"../escaped", "../../etc/x", "nested/../../escaped", "/tmp/absolute"} {
+		err := sink.Write(id, "png", strings.NewReader("data"))
+		if err == nil || !strings.Contains(err.Error(), "outside") {
+			t.Errorf("expected writing '%s' to be refused, got %v", id, err)
+		}
+		if sink.Exists(id, "png") {
+			t.Errorf("expected '%s' not to exist", id)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escaped.png")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written outside the directory, got %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the directory not to be created for refused identifiers, got %v", err)
+	}
+}
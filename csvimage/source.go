@@ -0,0 +1,165 @@
+package csvimage
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A source of records to convert, such as the rows of a CSV. Next returns io.EOF
+// once there are no more records.
+type RecordSource interface {
+	Next() (id, data string, err error)
+}
+
+// Implemented by sources whose records have fields besides the identifier and
+// data, such as the other columns of a CSV row.
+type FieldSource interface {
+	RecordSource
+	// Returns every field of the record last returned by Next, including the
+	// identifier and data.
+	Fields() []string
+}
+
+// Returned by CSVSource for a row without a data column. Reading can continue
+// with the next row.
+type ShortRowError struct {
+	Row    int
+	Fields int
+	// How many fields the row needed to have.
+	Want int
+}
+
+func (e *ShortRowError) Error() string {
+	return fmt.Sprintf("row %d: expected at least %d fields, found %d", e.Row, e.Want, e.Fields)
+}
+
+// Reads rows of fields one at a time, returning io.EOF after the last. A
+// *csv.Reader is one.
+type RowReader interface {
+	Read() (record []string, err error)
+}
+
+// Reads records from the rows of a CSV, or of anything else read as rows of fields.
+// By default rows are of the form '<identifier>,<data>,...'; the other columns are
+// available from Fields.
+type CSVSource struct {
+	// The indexes of the identifier and data columns, 0 and 1 by default.
+	IDColumn   int
+	DataColumn int
+
+	r      RowReader
+	row    int
+	record []string
+}
+
+func NewCSVSource(r RowReader) *CSVSource {
+	return &CSVSource{IDColumn: 0, DataColumn: 1, r: r}
+}
+
+// Reads the first row as a header, and returns it. The identifier and data columns
+// are chosen by name from the header, unless their names are empty. Row numbers
+// count from the row after the header.
+func (s *CSVSource) ReadHeader(idName, dataName string) ([]string, error) {
+	header, err := s.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	// The reader may reuse the slice for the next row.
+	header = append([]string(nil), header...)
+	if err := checkDuplicateColumns(header); err != nil {
+		return nil, err
+	}
+
+	if idName != "" {
+		if s.IDColumn, err = HeaderColumn(header, idName); err != nil {
+			return nil, err
+		}
+	}
+	if dataName != "" {
+		if s.DataColumn, err = HeaderColumn(header, dataName); err != nil {
+			return nil, err
+		}
+	}
+	if s.IDColumn == s.DataColumn {
+		return nil, fmt.Errorf("the identifier and data are both in column %d", s.IDColumn)
+	}
+	return header, nil
+}
+
+// Returns an error listing every name shared by more than one column of a header,
+// with the columns that have it, since any of them could be taken for the other.
+// Columns without a name don't count.
+func checkDuplicateColumns(header []string) error {
+	cols := map[string][]string{}
+	var names []string
+	for i, name := range header {
+		if name == "" {
+			continue
+		}
+		if len(cols[name]) == 1 {
+			names = append(names, name)
+		}
+		cols[name] = append(cols[name], strconv.Itoa(i))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	duplicates := make([]string, len(names))
+	for i, name := range names {
+		n := len(cols[name])
+		duplicates[i] = fmt.Sprintf("'%s' (columns %s and %s)", name, strings.Join(cols[name][:n-1], ", "), cols[name][n-1])
+	}
+	return fmt.Errorf("the header has more than one column with the same name: %s", strings.Join(duplicates, ", "))
+}
+
+// Returns the index of the column of a CSV header with the given name, which must
+// be unique.
+func HeaderColumn(header []string, name string) (int, error) {
+	col := -1
+	for i, field := range header {
+		if field != name {
+			continue
+		}
+		if col >= 0 {
+			return 0, fmt.Errorf("the header has more than one column named '%s' (columns %d and %d)", name, col, i)
+		}
+		col = i
+	}
+	if col < 0 {
+		return 0, fmt.Errorf("the header has no column named '%s'", name)
+	}
+	return col, nil
+}
+
+func (s *CSVSource) Next() (id, data string, err error) {
+	s.record, err = s.r.Read()
+	if err == io.EOF {
+		return "", "", err
+	}
+
+	// Rows that can't be parsed are counted too, since reading can carry on past
+	// them.
+	s.row++
+	if err != nil {
+		return "", "", err
+	}
+	if want := s.width(); len(s.record) < want {
+		return "", "", &ShortRowError{Row: s.row, Fields: len(s.record), Want: want}
+	}
+	return s.record[s.IDColumn], s.record[s.DataColumn], nil
+}
+
+// Returns how many fields a row needs to have both the identifier and data.
+func (s *CSVSource) width() int {
+	if s.IDColumn > s.DataColumn {
+		return s.IDColumn + 1
+	}
+	return s.DataColumn + 1
+}
+
+func (s *CSVSource) Fields() []string {
+	return s.record
+}
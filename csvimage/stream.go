@@ -0,0 +1,161 @@
+package csvimage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/ascii85"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+)
+
+// Like NewDecoder, but decodes the data as it's read from `r`, for data too long
+// to hold in memory as a string. Base-64 needn't say up front which variant it
+// is: URL-safe characters and padding are accepted wherever they appear.
+// Percent-encoded data URIs are read as they are, without unescaping them.
+func NewStreamDecoder(r io.Reader, encoding string) io.Reader {
+	return decompressPayload(decodeStream(r, encoding))
+}
+
+// Like NewVerbatimDecoder, but decodes the data as it's read from `r`.
+func NewVerbatimStreamDecoder(r io.Reader, encoding string) io.Reader {
+	return decodeStream(r, encoding)
+}
+
+// The stream decoder for each of the Encodings.
+var streamDecoders = map[string]func(r *bufio.Reader) io.Reader{
+	"base64":  newBase64OrHexStreamDecoder,
+	"base32":  newBase32StreamDecoder,
+	"ascii85": newASCII85StreamDecoder,
+	"hex":     newHexStreamDecoder,
+	"raw":     func(r *bufio.Reader) io.Reader { return r },
+}
+
+// How much of the start of the data is searched for the comma that ends a data
+// URI's header. Headers are far shorter.
+const maxDataURIHeader = 256
+
+// Decodes data read from `r` with the stream decoder for `encoding`, or base-64
+// if it isn't one of the Encodings, unless it's a data URI.
+func decodeStream(r io.Reader, encoding string) io.Reader {
+	decode, ok := streamDecoders[encoding]
+	if !ok {
+		decode = streamDecoders["base64"]
+	}
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(maxDataURIHeader)
+	if _, _, isBase64, ok := parseDataURI(string(head)); ok {
+		br.Discard(bytes.IndexByte(head, ',') + 1)
+		if isBase64 {
+			return newBase64StreamDecoder(br)
+		}
+		return br
+	}
+	return decode(br)
+}
+
+func newBase64OrHexStreamDecoder(r *bufio.Reader) io.Reader {
+	if prefix, _ := r.Peek(2); string(prefix) == `\x` {
+		return newHexStreamDecoder(r)
+	}
+	return newBase64StreamDecoder(r)
+}
+
+// Whitespace, which is dropped from every encoding.
+const whitespace = "\t\n\r "
+
+// Base-64 of either alphabet, padded or not, read as unpadded standard base-64.
+var base64Text = newByteMap(whitespace+"=", "-_", "+/")
+
+func newBase64StreamDecoder(r *bufio.Reader) io.Reader {
+	return base64.NewDecoder(base64.RawStdEncoding, &mappedReader{r: r, m: base64Text})
+}
+
+var base32Text = newByteMap(whitespace+"=", "", "")
+
+func newBase32StreamDecoder(r *bufio.Reader) io.Reader {
+	return base32.NewDecoder(base32.StdEncoding.WithPadding(base32.NoPadding), &mappedReader{r: r, m: base32Text})
+}
+
+var plainText = newByteMap(whitespace, "", "")
+
+func newHexStreamDecoder(r *bufio.Reader) io.Reader {
+	text := bufio.NewReader(&mappedReader{r: r, m: plainText})
+	if prefix, _ := text.Peek(2); string(prefix) == `\x` || string(prefix) == "0x" {
+		text.Discard(2)
+	}
+	return hex.NewDecoder(text)
+}
+
+func newASCII85StreamDecoder(r *bufio.Reader) io.Reader {
+	// Adobe-style ASCII85 is wrapped in '<~' and '~>'. The '~' can't appear
+	// anywhere else, so the data ends at the first one.
+	text := bufio.NewReader(&mappedReader{r: r, m: plainText})
+	if prefix, _ := text.Peek(2); string(prefix) == "<~" {
+		text.Discard(2)
+	}
+	return ascii85.NewDecoder(&untilByte{r: text, end: '~'})
+}
+
+// Maps each byte of some text to the byte it's read as, or to -1 to drop it.
+type byteMap [256]int16
+
+// Returns a map that drops the bytes in `drop`, replaces each byte in `from` with
+// the one at the same index in `to`, and keeps every other byte as it is.
+func newByteMap(drop, from, to string) *byteMap {
+	var m byteMap
+	for i := range m {
+		m[i] = int16(i)
+	}
+	for i := 0; i < len(drop); i++ {
+		m[drop[i]] = -1
+	}
+	for i := 0; i < len(from); i++ {
+		m[from[i]] = int16(to[i])
+	}
+	return &m
+}
+
+// Reads text through a byteMap.
+type mappedReader struct {
+	r io.Reader
+	m *byteMap
+}
+
+func (r *mappedReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if c := r.m[b]; c >= 0 {
+				p[kept] = byte(c)
+				kept++
+			}
+		}
+		// A read that dropped everything it got is no reason to stop.
+		if kept > 0 || err != nil || n == 0 {
+			return kept, err
+		}
+	}
+}
+
+// Reads up to, but not including, the first `end` byte.
+type untilByte struct {
+	r    io.Reader
+	end  byte
+	done bool
+}
+
+func (r *untilByte) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	if i := bytes.IndexByte(p[:n], r.end); i >= 0 {
+		r.done = true
+		return i, nil
+	}
+	return n, err
+}
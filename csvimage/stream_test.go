@@ -0,0 +1,62 @@
+package csvimage
+
+import (
+	"bytes"
+	"encoding/ascii85"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"image/color"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	original := encodePNG(t, solidImage(5, 4, color.White))
+	a85 := make([]byte, ascii85.MaxEncodedLen(len(original)))
+	a85 = a85[:ascii85.Encode(a85, original)]
+	std := base64.StdEncoding.EncodeToString(original)
+
+	tests := []struct {
+		encoding, data string
+	}{
+		{"base64", std},
+		{"base64", base64.RawURLEncoding.EncodeToString(original)},
+		{"base64", std[:40] + "\r\n" + std[40:]},
+		{"base64", "data:image/png;base64," + std},
+		{"base64", `\x` + hex.EncodeToString(original)},
+		{"base32", base32.StdEncoding.EncodeToString(original)},
+		{"hex", hex.EncodeToString(original)},
+		{"hex", "0x" + hex.EncodeToString(original)},
+		{"ascii85", "<~" + string(a85) + "~>"},
+		{"raw", string(original)},
+	}
+	for _, test := range tests {
+		// One byte at a time, so that nothing relies on reading it all at once.
+		r := iotest.OneByteReader(strings.NewReader(test.data))
+		decoded, err := ioutil.ReadAll(NewStreamDecoder(r, test.encoding))
+		if err != nil {
+			t.Fatalf("%s %.30q: %s", test.encoding, test.data, err)
+		}
+		if !bytes.Equal(decoded, original) {
+			t.Errorf("%s %.30q decoded to the wrong bytes", test.encoding, test.data)
+		}
+	}
+}
+
+func TestConvertWithMore(t *testing.T) {
+	original := encodePNG(t, solidImage(5, 4, color.White))
+	data := base64.StdEncoding.EncodeToString(original)
+
+	var out bytes.Buffer
+	rec := Record{ID: "a", Data: data[:10], More: strings.NewReader(data[10:])}
+	res, err := (&Converter{}).Convert(rec, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Detected != "png" || res.Width != 5 || res.Height != 4 {
+		t.Errorf("expected a 5x4 png, got %s %dx%d", res.Detected, res.Width, res.Height)
+	}
+}
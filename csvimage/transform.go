@@ -0,0 +1,148 @@
+package csvimage
+
+import (
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Exact output dimensions to scale images to fit, and the color used to pad any
+// space left over after scaling an image to fit them.
+type Fit struct {
+	Width  int
+	Height int
+	Pad    color.Color
+}
+
+// Settings for trimming a uniformly colored border from images.
+type Trim struct {
+	// The border color to trim, or nil to use the color of the top-left pixel.
+	Color color.Color
+	// How far each color channel (0-255) may differ from the border color and
+	// still count as border.
+	Tolerance int
+}
+
+// Reports whether any transforms that change an image's pixels are set.
+func (c *Converter) HasTransforms() bool {
+	return c.Crop != nil || c.Trim != nil || c.Fit != nil
+}
+
+// Applies the converter's transforms to a decoded image. When several are set
+// they're always applied in the same order: Crop first, so that its coordinates
+// refer to the original image, then Trim, and finally Fit, so that the output has
+// exactly the requested dimensions.
+func (c *Converter) Transform(img image.Image) image.Image {
+	if c.Crop != nil {
+		img = cropRegion(img, *c.Crop)
+	}
+	if c.Trim != nil {
+		img = trimBorder(img, c.Trim)
+	}
+	if c.Fit != nil {
+		img = fit(img, c.Fit)
+	}
+	return img
+}
+
+// Scales `img` to fit within the dimensions of `spec` while preserving its aspect
+// ratio, then centers it on a canvas of exactly those dimensions filled with the
+// padding color.
+func fit(img image.Image, spec *Fit) image.Image {
+	src := img.Bounds()
+	scale := float64(spec.Width) / float64(src.Dx())
+	if s := float64(spec.Height) / float64(src.Dy()); s < scale {
+		scale = s
+	}
+
+	w := int(float64(src.Dx())*scale + 0.5)
+	h := int(float64(src.Dy())*scale + 0.5)
+	x := (spec.Width - w) / 2
+	y := (spec.Height - h) / 2
+
+	dst := image.NewRGBA(image.Rect(0, 0, spec.Width, spec.Height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(spec.Pad), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, image.Rect(x, y, x+w, y+h), img, src, draw.Over, nil)
+
+	return dst
+}
+
+// Crops away any uniformly colored border around `img`. If the whole image is the
+// border color it's returned unchanged.
+func trimBorder(img image.Image, spec *Trim) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+
+	border := spec.Color
+	if border == nil {
+		border = img.At(b.Min.X, b.Min.Y)
+	}
+	isBorder := func(x, y int) bool {
+		return colorsMatch(img.At(x, y), border, spec.Tolerance)
+	}
+
+	content := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isBorder(x, y) {
+				continue
+			}
+			if x < content.Min.X {
+				content.Min.X = x
+			}
+			if y < content.Min.Y {
+				content.Min.Y = y
+			}
+			if x+1 > content.Max.X {
+				content.Max.X = x + 1
+			}
+			if y+1 > content.Max.Y {
+				content.Max.Y = y + 1
+			}
+		}
+	}
+
+	if content.Empty() || content == b {
+		return img
+	}
+	return crop(img, content)
+}
+
+// Reports whether every channel of `a` is within `tolerance` (0-255) of `b`.
+func colorsMatch(a, b color.Color, tolerance int) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	within := func(x, y uint32) bool {
+		d := int(x>>8) - int(y>>8)
+		return d <= tolerance && d >= -tolerance
+	}
+	return within(r1, r2) && within(g1, g2) && within(b1, b2) && within(a1, a2)
+}
+
+// Crops `img` to `r`, given relative to the image's top-left corner and clamped to
+// its bounds. If `r` lies entirely outside the image it's returned unchanged.
+func cropRegion(img image.Image, r image.Rectangle) image.Image {
+	b := img.Bounds()
+	r = r.Add(b.Min).Intersect(b)
+	if r.Empty() || r == b {
+		return img
+	}
+	return crop(img, r)
+}
+
+// Returns the part of `img` within `r`, sharing pixels with the original where the
+// image type allows it.
+func crop(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
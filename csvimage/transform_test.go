@@ -0,0 +1,90 @@
+package csvimage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFitPadsToExactSize(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	conv := &Converter{Fit: &Fit{Width: 40, Height: 20, Pad: red}}
+
+	img, _ := convertImage(t, conv, solidImage(10, 10, blue))
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+		t.Fatalf("expected a 40x20 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	// A square image fills the height, leaving margins at the sides.
+	for _, x := range []int{0, 5, 34, 39} {
+		if c := img.At(x, 10); !sameColor(c, red) {
+			t.Errorf("expected padding at (%d, 10), got %v", x, c)
+		}
+	}
+	if c := img.At(20, 10); !sameColor(c, blue) {
+		t.Errorf("expected the image at (20, 10), got %v", c)
+	}
+}
+
+func TestTrimBorder(t *testing.T) {
+	blue := color.NRGBA{B: 255, A: 255}
+	nearWhite := color.NRGBA{R: 250, G: 250, B: 250, A: 255}
+	img := solidImage(10, 8, color.White)
+	for y := 2; y < 6; y++ {
+		for x := 3; x < 8; x++ {
+			img.Set(x, y, blue)
+		}
+	}
+	// A speck that's close enough to the border color to count as border.
+	img.Set(0, 7, nearWhite)
+
+	trimmed, _ := convertImage(t, &Converter{Trim: &Trim{Tolerance: 10}}, img)
+	if b := trimmed.Bounds(); b.Dx() != 5 || b.Dy() != 4 {
+		t.Fatalf("expected the 5x4 content, got %dx%d", b.Dx(), b.Dy())
+	}
+	b := trimmed.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if c := trimmed.At(x, y); !sameColor(c, blue) {
+				t.Fatalf("expected only the content to be left, found %v at (%d, %d)", c, x, y)
+			}
+		}
+	}
+
+	// Without any tolerance the speck is content too.
+	strict, _ := convertImage(t, &Converter{Trim: &Trim{Color: color.White}}, img)
+	if b := strict.Bounds(); b.Dx() != 8 || b.Dy() != 6 {
+		t.Errorf("expected the speck to be kept without tolerance, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestCrop(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 30), G: uint8(y * 40), A: 255})
+		}
+	}
+
+	region := image.Rect(2, 1, 5, 3)
+	cropped, _ := convertImage(t, &Converter{Crop: &region}, img)
+	b := cropped.Bounds()
+	if b.Dx() != 3 || b.Dy() != 2 {
+		t.Fatalf("expected a 3x2 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			if got, want := cropped.At(b.Min.X+x, b.Min.Y+y), img.At(2+x, 1+y); !sameColor(got, want) {
+				t.Errorf("(%d, %d): expected %v, got %v", x, y, want, got)
+			}
+		}
+	}
+
+	// A region running off the image is clamped to it.
+	region = image.Rect(6, 4, 20, 20)
+	clamped, _ := convertImage(t, &Converter{Crop: &region}, img)
+	if b := clamped.Bounds(); b.Dx() != 2 || b.Dy() != 2 {
+		t.Errorf("expected the crop to be clamped to 2x2, got %dx%d", b.Dx(), b.Dy())
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// One of the columns given to -data-cols: its index, or its name in the header,
+// and the suffix added to each row's identifier to name the image from it.
+type dataColumn struct {
+	index  int
+	name   string
+	suffix string
+}
+
+// Parses a -data-cols value: a comma-separated list of columns, each an index or,
+// with -header, a name, optionally followed by '=<suffix>'. Suffixes default to the
+// column's name or index.
+func parseDataColumns(value string, header bool) ([]dataColumn, error) {
+	var cols []dataColumn
+	suffixes := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		column, suffix := part, ""
+		if i := strings.LastIndex(part, "="); i >= 0 {
+			column, suffix = part[:i], part[i+1:]
+			if suffix == "" {
+				return nil, fmt.Errorf("invalid -data-cols '%s': empty suffix for column '%s'", value, column)
+			}
+		}
+		column = strings.TrimSpace(column)
+
+		col := dataColumn{index: -1, suffix: suffix}
+		if index, err := strconv.Atoi(column); err == nil {
+			if index < 0 {
+				return nil, fmt.Errorf("invalid -data-cols '%s': negative column %d", value, index)
+			}
+			col.index = index
+		} else if header {
+			col.name = column
+		} else {
+			return nil, fmt.Errorf("invalid -data-cols '%s': columns can only be chosen by name with -header", value)
+		}
+		if col.suffix == "" {
+			col.suffix = column
+		}
+
+		if suffixes[col.suffix] {
+			return nil, fmt.Errorf("invalid -data-cols '%s': more than one column has the suffix '%s'", value, col.suffix)
+		}
+		suffixes[col.suffix] = true
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// Returns the data columns with the indexes of those chosen by name looked up in
+// `header`, checking that none of them is the identifier column.
+func resolveDataColumns(cols []dataColumn, header []string, idColumn int) ([]dataColumn, error) {
+	resolved := make([]dataColumn, len(cols))
+	for i, col := range cols {
+		if col.name != "" {
+			index, err := csvimage.HeaderColumn(header, col.name)
+			if err != nil {
+				return nil, err
+			}
+			col.index = index
+		}
+		if col.index == idColumn {
+			return nil, fmt.Errorf("column %d can't hold both identifiers and data", col.index)
+		}
+		resolved[i] = col
+	}
+	return resolved, nil
+}
+
+// The identifier and data of one of the images in a row.
+type rowImage struct {
+	id   string
+	data string
+}
+
+// Returns the images in a row: with -data-cols, one for each data column, whose
+// identifiers have the column's suffix added; otherwise just the row's own.
+func rowImages(id, data string, record []string, cols []dataColumn) []rowImage {
+	if cols == nil {
+		return []rowImage{{id, data}}
+	}
+
+	images := make([]rowImage, len(cols))
+	for i, col := range cols {
+		images[i] = rowImage{id + "_" + col.suffix, record[col.index]}
+	}
+	return images
+}
+
+// Keeps track of the images of a row with several data columns, which are
+// converted separately. A nil rowParts is for a row with just one image.
+type rowParts struct {
+	mu        sync.Mutex
+	remaining int
+	failed    bool
+}
+
+func newRowParts(images int) *rowParts {
+	if images < 2 {
+		return nil
+	}
+	return &rowParts{remaining: images}
+}
+
+// Records that one of the row's images has finished, and reports whether it was
+// the last of them.
+func (p *rowParts) finish() bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remaining--
+	return p.remaining == 0
+}
+
+// Records that one of the row's images couldn't be converted, and reports whether
+// it's the first of them that couldn't be.
+func (p *rowParts) fail() bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	first := !p.failed
+	p.failed = true
+	return first
+}
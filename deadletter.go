@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"sync"
+)
+
+// Reports whether two paths name the same existing file.
+func sameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// A CSV of the original rows whose data couldn't be decoded or written, in the
+// same layout as the input, so that they can be fixed and converted again without
+// the rest. Safe for concurrent use.
+type deadLetter struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+// Creates or replaces the dead-letter CSV at `path`, separating fields with
+// `delimiter` like the input.
+func createDeadLetter(path string, delimiter rune) (*deadLetter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(f)
+	w.Comma = delimiter
+	return &deadLetter{f: f, w: w}, nil
+}
+
+// Adds a row, which is flushed straight away so that the file is up to date even
+// if the run is killed. The header of the input, with -header, is added the same
+// way before any rows.
+func (d *deadLetter) add(record []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Write(record)
+	d.w.Flush()
+	return d.w.Error()
+}
+
+func (d *deadLetter) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"image"
+	"io"
+	"strconv"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Reports the format and dimensions of every image in a CSV as CSV rows of
+// '<identifier>,<format>,<width>,<height>', without decoding any pixels or writing
+// any files. Rows whose data isn't a recognizable image are reported as 'unknown',
+// as are rows that are malformed or too short to have any data, under whatever
+// identifier they have.
+func detectFormats(reader recordReader, w io.Writer, opts *options) error {
+	in, err := newCSVSource(reader, opts)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "format", "width", "height"})
+
+	for {
+		id, data, err := in.Next()
+		if err == io.EOF {
+			break
+		}
+		var short *csvimage.ShortRowError
+		var parseErr *csv.ParseError
+		if errors.As(err, &short) || errors.As(err, &parseErr) || (err == nil && len(in.Fields()) < in.width()) {
+			// The reader carries on from the next row.
+			if fields := in.Fields(); in.IDColumn < len(fields) {
+				id = fields[in.IDColumn]
+			}
+			out.Write([]string{id, "unknown", "", ""})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, img := range rowImages(id, data, in.Fields(), in.dataCols) {
+			config, format, err := image.DecodeConfig(csvimage.NewDecoder(img.data, opts.conv.Encoding))
+			if err != nil {
+				out.Write([]string{img.id, "unknown", "", ""})
+				continue
+			}
+			out.Write([]string{img.id, format, strconv.Itoa(config.Width), strconv.Itoa(config.Height)})
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
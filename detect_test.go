@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetectFormats(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	jpegData := base64.StdEncoding.EncodeToString(jpegBytes(t, testImage(8, 5)))
+	path := writeTemp(t, "input.csv", "a,"+pngData(t)+"\n"+
+		"b,"+jpegData+"\n"+
+		"c,bm90IGFuIGltYWdl\n"+
+		"lonely\n"+
+		"bad\"quote,x\n"+
+		"d,"+pngData(t)+"\n")
+
+	reader, file, err := parseCSV(path, opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var out bytes.Buffer
+	if err := detectFormats(reader, &out, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,format,width,height\n" +
+		"a,png,4,3\n" +
+		"b,jpeg,8,5\n" +
+		"c,unknown,,\n" +
+		"lonely,unknown,,\n" +
+		",unknown,,\n" +
+		"d,png,4,3\n"
+	if out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
+	}
+
+	if files, _ := ioutil.ReadDir(opts.outputDir); len(files) > 0 {
+		t.Errorf("expected no files to be written, found %d", len(files))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Converts each of `files`, up to `workers` files at a time. Each file's images are
+// written to a subdirectory of the output directory named after the file's path
+// relative to `root`, minus its extension, so that IDs repeated across files don't
+// collide. If `finished` isn't nil, it's called with each file that's converted,
+// or that fails, without being interrupted, and the error it failed with.
+func convertFiles(ctx context.Context, root string, files []string, opts *options, stats *summary, workers int, finished func(file string, err error)) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mu sync.Mutex
+	var failures []string
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, file := range files {
+		if ctx.Err() != nil || opts.onError.exceeded(stats) {
+			break
+		}
+
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return err
+		}
+		fileOpts := *opts
+		fileOpts.outputDir = filepath.Join(opts.outputDir, csvStem(rel, opts.inputFormat))
+		fileOpts.sink = &csvimage.DirSink{Dir: fileOpts.outputDir}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(file string, opts *options) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := convertFile(ctx, file, opts, stats)
+			if err != nil && !errors.Is(err, errInterrupted) && !errors.Is(err, errTooManyFailures) {
+				fmt.Fprintf(opts.messages, "Failed to convert '%s': %s\n", file, err)
+				mu.Lock()
+				failures = append(failures, file)
+				mu.Unlock()
+			}
+			if finished != nil && !errors.Is(err, errInterrupted) {
+				mu.Lock()
+				finished(file, err)
+				mu.Unlock()
+			}
+		}(file, &fileOpts)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if opts.onError.exceeded(stats) {
+		return errTooManyFailures
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to convert %d of %d files: %s", len(failures), len(files), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// Returns the paths of every CSV file in `dir`, or file of another -input-format,
+// including compressed ones, in lexical order. If `recursive`, those in its
+// subdirectories are included too.
+func findCSVs(dir, format string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != dir && !recursive {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && csvStem(path, format) != path {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// The extensions of the files of each -input-format.
+var formatExtensions = map[string][]string{
+	"csv":     {".csv"},
+	"jsonl":   {".jsonl", ".ndjson"},
+	"json":    {".json"},
+	"xlsx":    {".xlsx"},
+	"avro":    {".avro"},
+	"parquet": {".parquet"},
+}
+
+// Strips the extension of a file of the given -input-format, like '.csv', alone or
+// followed by that of a supported compression, from `path`, returning it unchanged
+// if it has neither.
+func csvStem(path, format string) string {
+	for _, ext := range formatExtensions[format] {
+		for _, compressed := range []string{"", ".gz", ".zst", ".br"} {
+			if strings.HasSuffix(strings.ToLower(path), ext+compressed) {
+				return path[:len(path)-len(ext+compressed)]
+			}
+		}
+	}
+	return path
+}
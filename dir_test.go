@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes files beneath `dir`, creating their directories, from a map of relative
+// paths to contents.
+func writeTree(t testing.TB, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, contents, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecursiveConversion(t *testing.T) {
+	root := t.TempDir()
+	row := []byte("a," + pngData(t) + "\n")
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(row)
+	w.Close()
+	writeTree(t, root, map[string][]byte{
+		"top.csv":             row,
+		"2024/jan.csv":        row,
+		"2024/feb.csv.gz":     gz.Bytes(),
+		"2024/deep/march.csv": row,
+		"2024/notes.txt":      []byte("not a CSV"),
+	})
+
+	files, err := findCSVs(root, "csv", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 CSVs, found %v", files)
+	}
+	if shallow, _ := findCSVs(root, "csv", false); len(shallow) != 1 {
+		t.Errorf("expected 1 CSV without recursing, found %v", shallow)
+	}
+
+	opts := testOptions(t.TempDir())
+	stats := newSummary()
+	if err := convertFiles(context.Background(), root, files, opts, stats, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 4 {
+		t.Fatalf("expected 4 images written, got %s", stats)
+	}
+	// Each CSV's images go to a directory named after it, so the same identifier in
+	// each doesn't collide.
+	for _, dir := range []string{"top", "2024/jan", "2024/feb", "2024/deep/march"} {
+		if _, err := os.Stat(filepath.Join(opts.outputDir, dir, "a.png")); err != nil {
+			t.Errorf("expected %s/a.png: %s", dir, err)
+		}
+	}
+}
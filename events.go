@@ -0,0 +1,32 @@
+package main
+
+import "encoding/json"
+
+// Describes the outcome of converting a row, printed as a line of JSON with
+// -log-format ndjson.
+type rowEvent struct {
+	ID string `json:"id"`
+	// The identifier as it was in the input, if -strip-prefix removed part of it.
+	OriginalID string `json:"original_id,omitempty"`
+	Row        int    `json:"row"`
+	// One of the results counted in the summary: written, raw, dumped, too_large
+	// or failed.
+	Result string `json:"result"`
+	// The format the image decoder reported, if the data could be decoded.
+	Format string `json:"format,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// Where the image, or the data that couldn't be converted, was written.
+	Output string `json:"output,omitempty"`
+	Bytes  int    `json:"bytes,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Whether the image was converted but couldn't be written, which trying again
+	// may fix, unlike data that couldn't be converted.
+	writeFailed bool
+}
+
+// Returns the event as a line of JSON.
+func (e *rowEvent) line() string {
+	out, _ := json.Marshal(e)
+	return string(out) + "\n"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// Exit statuses, so that scripts can tell how a run went without parsing its
+// output. Invalid options, and other problems that stop a run before it starts,
+// exit with status 1.
+const (
+	// Every row was converted, or deliberately skipped.
+	exitOK = 0
+	// The CSV couldn't be opened or parsed.
+	exitInputUnreadable = 3
+	// Some rows couldn't be converted, and were dumped or counted as errors.
+	exitSomeFailed = 4
+	// None of the rows could be converted.
+	exitAllFailed = 5
+	// The run was stopped early by -on-error.
+	exitTooManyFailures = 6
+	// The run was interrupted before every row was converted, as is conventional
+	// for SIGINT.
+	exitInterrupted = 130
+)
+
+// Logs an error reading the input and exits.
+func fatalInput(err error) {
+	log.Println(err)
+	os.Exit(exitInputUnreadable)
+}
+
+// Returns the exit status describing the rows of a finished run. Rows that were
+// too large to write, or written raw, were dealt with as requested, so they don't
+// count as failures.
+func (s *summary) exitCode() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, total := s.dumped+s.errors, s.total
+	switch {
+	case failures == 0:
+		return exitOK
+	case failures == total:
+		return exitAllFailed
+	default:
+		return exitSomeFailed
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Returned for a row with a field longer than -max-field-bytes.
+type fieldTooLargeError struct {
+	max int64
+}
+
+func (e *fieldTooLargeError) Error() string {
+	return fmt.Sprintf("a field is longer than %d bytes", e.max)
+}
+
+// Where a fieldLimiter is within a field.
+type quoteState int
+
+const (
+	fieldStart quoteState = iota
+	unquoted
+	quoted
+	// A quote in a quoted field, which either ends it or escapes another quote.
+	closingQuote
+)
+
+// Limits the length of the fields of a CSV before csv.Reader reads them, since it
+// keeps the whole of every field in memory. When a field runs over, the rest of it
+// is spooled to a temporary file, and a marker put in its place (see spooler).
+// Without a spooler, the rest of its row is read through and dropped instead, and
+// the row is ended early with as many fields as it had and a *fieldTooLargeError,
+// which csv.Reader returns for that row before carrying on with the next. Only the
+// quoting of fields is understood, which is enough to find where they end.
+type fieldLimiter struct {
+	r      *bufio.Reader
+	delim  []byte
+	max    int64
+	spools *spooler
+
+	state quoteState
+	// The length of the field so far, and how much of a delimiter the bytes since
+	// the last of them match.
+	length  int64
+	matched int
+
+	// What takes the place of the end of a field that was cut short, to be read
+	// before err, if there is one, and whatever had been read past the field.
+	tail []byte
+	err  error
+	rest []byte
+	// Where a spooled field is read into.
+	buf []byte
+}
+
+// Returns a fieldLimiter that spools fields over `max` bytes with `spools`, or
+// drops their rows if it's nil.
+func newFieldLimiter(r io.Reader, delimiter rune, max int64, spools *spooler) *fieldLimiter {
+	delim := make([]byte, utf8.RuneLen(delimiter))
+	utf8.EncodeRune(delim, delimiter)
+	return &fieldLimiter{r: bufio.NewReader(r), delim: delim, max: max, spools: spools}
+}
+
+func (l *fieldLimiter) Read(p []byte) (int, error) {
+	if len(l.tail) > 0 || l.err != nil {
+		return l.readTail(p)
+	}
+
+	var n int
+	var err error
+	if len(l.rest) > 0 {
+		n = copy(p, l.rest)
+		l.rest = l.rest[n:]
+	} else {
+		n, err = l.r.Read(p)
+	}
+
+	for i := 0; i < n; i++ {
+		if k := l.plain(p[i:n]); k > 0 {
+			if room := l.max - l.length; int64(k) > room {
+				k = int(room)
+			}
+			l.length += int64(k)
+			if i += k; i == n {
+				break
+			}
+		}
+
+		before, matched := l.state, l.matched
+		l.scan(p[i])
+		if l.length <= l.max {
+			continue
+		}
+
+		// Part of a delimiter has already been returned when it's more than one
+		// byte, so there's no cutting the field short there.
+		if l.spools != nil && (before == quoted || before == unquoted && matched == 0) {
+			l.state = before
+			tail, rest, err := l.spool(append(p[i:n:n], l.rest...))
+			l.tail, l.err = tail, err
+			l.rest = append([]byte(nil), rest...)
+			m, err := l.readTail(p[i:])
+			return i + m, err
+		}
+
+		// Return the row up to this byte, finished off so that it parses.
+		if before == quoted {
+			l.tail = append(l.tail, '"')
+		}
+		fields, rest := l.drop(append(p[i+1:n:n], l.rest...))
+		for ; fields > 0; fields-- {
+			l.tail = append(l.tail, l.delim...)
+		}
+		l.rest = append([]byte(nil), rest...)
+		l.err = &fieldTooLargeError{l.max}
+
+		m, err := l.readTail(p[i:])
+		return i + m, err
+	}
+	return n, err
+}
+
+// Reads what takes the place of the end of a field that was cut short, returning
+// its error, if any, with the last of it.
+func (l *fieldLimiter) readTail(p []byte) (int, error) {
+	n := copy(p, l.tail)
+	l.tail = l.tail[n:]
+	if len(l.tail) > 0 {
+		return n, nil
+	}
+	err := l.err
+	l.tail, l.err = nil, nil
+	return n, err
+}
+
+// Spools the rest of a field that's run over the limit, starting with `buffered`
+// and reading on as far as the end of the field. Returns the marker to take its
+// place, followed by the quote that ended it if it was quoted, and whatever was
+// read past it, which starts with the delimiter or line break that ended it.
+func (l *fieldLimiter) spool(buffered []byte) (tail, rest []byte, err error) {
+	field, err := l.spools.create()
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(field.file)
+
+	// In an unquoted field, the bytes that may be the start of a delimiter or
+	// line break, and so the end of the field.
+	var held []byte
+	ended := false
+	for !ended {
+		for i := 0; i < len(buffered) && !ended; i++ {
+			switch l.state {
+			case quoted:
+				k := indexOrLen(buffered[i:], '"')
+				w.Write(buffered[i : i+k])
+				if i += k; i < len(buffered) {
+					l.state = closingQuote
+				}
+			case closingQuote:
+				if buffered[i] == '"' {
+					w.WriteByte('"')
+					l.state = quoted
+					continue
+				}
+				ended, rest = true, buffered[i:]
+			default:
+				if len(held) == 0 {
+					k := indexOrLen(buffered[i:], '\n')
+					k = indexOrLen(buffered[i:i+k], '\r')
+					k = indexOrLen(buffered[i:i+k], l.delim[0])
+					w.Write(buffered[i : i+k])
+					if i += k; i == len(buffered) {
+						break
+					}
+				}
+				held = append(held, buffered[i])
+				if l.endsField(held) {
+					ended, rest = true, append(held, buffered[i+1:]...)
+					break
+				}
+				if l.mayEndField(held) {
+					continue
+				}
+				// Not the end of the field after all, so the held bytes are part
+				// of it, and the last of them may start the end on its own.
+				held = held[:len(held)-1]
+				if len(held) > 0 {
+					w.Write(held)
+					held = held[:0]
+					i--
+					continue
+				}
+				w.WriteByte(buffered[i])
+			}
+		}
+		if ended {
+			break
+		}
+
+		if l.buf == nil {
+			l.buf = make([]byte, 64*1024)
+		}
+		n, err := l.r.Read(l.buf)
+		buffered = l.buf[:n]
+		if err != nil && n == 0 {
+			// The field ends with the file, and reading on returns the error again.
+			w.Write(held)
+			ended = true
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		field.Close()
+		return nil, nil, err
+	}
+	info, err := field.file.Stat()
+	if err != nil {
+		field.Close()
+		return nil, nil, err
+	}
+	field.size = info.Size()
+	l.spools.add(field)
+
+	tail = []byte(field.marker)
+	if l.state == closingQuote {
+		tail = append(tail, '"')
+	} else {
+		l.state, l.matched = unquoted, 0
+	}
+	l.length = 0
+	return tail, rest, nil
+}
+
+// Reports whether the bytes after an unquoted field are a delimiter or line break,
+// which end it.
+func (l *fieldLimiter) endsField(b []byte) bool {
+	return bytes.Equal(b, l.delim) || string(b) == "\n" || string(b) == "\r\n"
+}
+
+// Reports whether the bytes after an unquoted field may be the start of a
+// delimiter or line break.
+func (l *fieldLimiter) mayEndField(b []byte) bool {
+	return bytes.HasPrefix(l.delim, b) || string(b) == "\r"
+}
+
+// Reads through the rest of a row, starting with `buffered`, returning how many
+// more fields it had and whatever of `buffered` follows it.
+func (l *fieldLimiter) drop(buffered []byte) (fields int, rest []byte) {
+	for i := 0; i < len(buffered); i++ {
+		i += l.plain(buffered[i:])
+		if i == len(buffered) {
+			break
+		}
+		endField, endRow := l.scan(buffered[i])
+		if endRow {
+			return fields, buffered[i+1:]
+		}
+		if endField {
+			fields++
+		}
+	}
+
+	for {
+		// ReadSlice stops at line breaks, so a row never ends partway through what it
+		// returns.
+		line, err := l.r.ReadSlice('\n')
+		for i := 0; i < len(line); i++ {
+			i += l.plain(line[i:])
+			if i == len(line) {
+				break
+			}
+			endField, endRow := l.scan(line[i])
+			if endRow {
+				return fields, nil
+			}
+			if endField {
+				fields++
+			}
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			// The row ends with the file, and reading on returns the error again.
+			l.state, l.length, l.matched = fieldStart, 0, 0
+			return fields, nil
+		}
+	}
+}
+
+// Returns how many bytes at the start of `b` are just part of the current field,
+// which can be counted together rather than scanned one at a time, since most of
+// a CSV of images is long runs of them.
+func (l *fieldLimiter) plain(b []byte) int {
+	switch {
+	case l.state == quoted:
+		return indexOrLen(b, '"')
+	case l.state == unquoted && l.matched == 0:
+		n := indexOrLen(b, '\n')
+		return indexOrLen(b[:n], l.delim[0])
+	default:
+		return 0
+	}
+}
+
+// Returns the index of the first `c` in `b`, or its length if there isn't one.
+func indexOrLen(b []byte, c byte) int {
+	if i := bytes.IndexByte(b, c); i >= 0 {
+		return i
+	}
+	return len(b)
+}
+
+// Advances past a byte of the CSV, reporting whether it ended a field or a row.
+func (l *fieldLimiter) scan(b byte) (endField, endRow bool) {
+	switch l.state {
+	case quoted:
+		if b == '"' {
+			l.state = closingQuote
+		}
+		l.length++
+		return false, false
+	case closingQuote:
+		if b == '"' {
+			l.state = quoted
+			l.length++
+			return false, false
+		}
+	case fieldStart:
+		if b == '"' {
+			l.state = quoted
+			l.length++
+			return false, false
+		}
+	}
+
+	l.state = unquoted
+	if b == '\n' {
+		l.state, l.length, l.matched = fieldStart, 0, 0
+		return true, true
+	}
+	if b == l.delim[l.matched] {
+		l.matched++
+		if l.matched == len(l.delim) {
+			l.state, l.length, l.matched = fieldStart, 0, 0
+			return true, false
+		}
+	} else if b == l.delim[0] {
+		l.matched = 1
+	} else {
+		l.matched = 0
+	}
+	l.length++
+	return false, false
+}
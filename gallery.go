@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Collects the images written during a run, so that an index.html gallery of them
+// can be generated at the end. Safe for concurrent use.
+type gallery struct {
+	mu     sync.Mutex
+	images []galleryImage
+}
+
+type galleryImage struct {
+	ID   string
+	File string
+}
+
+// Adds an image, written to the file at `path`.
+func (g *gallery) add(id, path string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.images = append(g.images, galleryImage{ID: id, File: path})
+}
+
+// Writes an 'index.html' to `outputDir` showing every image added so far, ordered
+// by file name.
+func (g *gallery) write(outputDir string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	images := make([]galleryImage, len(g.images))
+	for i, img := range g.images {
+		rel, err := filepath.Rel(outputDir, img.File)
+		if err != nil {
+			return err
+		}
+		images[i] = galleryImage{ID: img.ID, File: filepath.ToSlash(rel)}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].File < images[j].File
+	})
+
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(outputDir, "index.html"))
+	if err != nil {
+		return err
+	}
+
+	err = galleryTemplate.Execute(f, images)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>csv-image output</title>
+<style>
+  body { font-family: sans-serif; margin: 1em; }
+  .grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(200px, 1fr)); gap: 1em; }
+  figure { margin: 0; text-align: center; }
+  img { max-width: 100%; height: auto; }
+  figcaption { font-size: 0.8em; word-break: break-all; }
+</style>
+</head>
+<body>
+<div class="grid">
+{{- range .}}
+  <figure>
+    <a href="{{.File}}"><img src="{{.File}}" alt="{{.ID}}" loading="lazy"></a>
+    <figcaption>{{.ID}}</figcaption>
+  </figure>
+{{- end}}
+</div>
+</body>
+</html>
+`))
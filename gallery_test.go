@@ -0,0 +1,28 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGalleryListsWrittenImages(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.gallery = &gallery{}
+	contents := "b," + pngData(t) + "\nbad,bm90IGFuIGltYWdl\na," + pngData(t) + "\n"
+	if _, err := convertCSV(t, contents, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.gallery.write(opts.outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	html := string(readOutput(t, opts, "index.html"))
+	var sources []string
+	for _, match := range regexp.MustCompile(`<img src="([^"]*)"`).FindAllStringSubmatch(html, -1) {
+		sources = append(sources, match[1])
+	}
+	if got := strings.Join(sources, ","); got != "a.png,b.png" {
+		t.Errorf("expected the gallery to show a.png and b.png, got %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Opens an object in Google Cloud Storage, given as 'gs://<bucket>/<object>', to
+// be read as it downloads. Credentials are Application Default Credentials, found
+// as gcloud finds them: from GOOGLE_APPLICATION_CREDENTIALS, the gcloud config, or
+// the instance's service account. If STORAGE_EMULATOR_HOST is set, the emulator
+// there is used instead, without credentials.
+func openGCS(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	bucket, object := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid GCS URL '%s': must be gs://<bucket>/<object>", rawURL)
+	}
+
+	endpoint, client := "https://storage.googleapis.com", http.DefaultClient
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = host
+		if !strings.Contains(host, "://") {
+			endpoint = "http://" + host
+		}
+	} else {
+		client, err = google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/devstorage.read_only")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google credentials: %s", err)
+		}
+	}
+
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", strings.TrimSuffix(endpoint, "/"), url.PathEscape(bucket), url.PathEscape(object))
+	resp, err := client.Get(objectURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch '%s': %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Parses a -delimiter value: a single character, or 'tab'.
+func parseDelimiter(value string) (rune, error) {
+	if value == "tab" || value == `\t` {
+		return '\t', nil
+	}
+
+	delimiter, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) {
+		return 0, fmt.Errorf("invalid -delimiter '%s': must be a single character, or 'tab'", value)
+	}
+	switch delimiter {
+	case '"', '\r', '\n', utf8.RuneError:
+		return 0, fmt.Errorf("invalid -delimiter %q: can't be a quote or line break", value)
+	}
+	return delimiter, nil
+}
+
+// Discards lines from the start of a reader the first time it's read, so that a
+// preamble that isn't CSV at all never reaches the CSV reader.
+type lineSkipper struct {
+	r     *bufio.Reader
+	lines int
+}
+
+func (s *lineSkipper) Read(p []byte) (int, error) {
+	for ; s.lines > 0; s.lines-- {
+		// Read a fragment at a time, since the line could be arbitrarily long.
+		for {
+			_, err := s.r.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+	return s.r.Read(p)
+}
+
+// The records of a CSV, along with its header, with -header, and its data columns,
+// with -data-cols.
+type csvInput struct {
+	*csvimage.CSVSource
+	header   []string
+	dataCols []dataColumn
+	// The indexes of the -mime-column and -part-column, or -1.
+	mimeCol int
+	partCol int
+	// The -meta-cols, unless they're all the columns the images aren't made from.
+	metaCols []int
+	metaAll  bool
+	// The index of the -format-col, or -1, which isn't metadata either.
+	formatCol int
+}
+
+// A reader of a format whose schema gives the type of each column.
+type schemaReader interface {
+	// Returns the names of the columns likely to be the identifier and data
+	// columns, or empty strings if there are none.
+	schemaColumns() (id, data string)
+}
+
+// Creates a source of records from a CSV, choosing the identifier and data columns
+// by index, or with -header by name. The header is read straight away, so a
+// missing or ambiguous column is reported before any rows are converted.
+func newCSVSource(reader csvimage.RowReader, opts *options) (*csvInput, error) {
+	in := &csvInput{CSVSource: csvimage.NewCSVSource(reader), mimeCol: -1, partCol: -1, formatCol: -1}
+	in.IDColumn, in.DataColumn = opts.idCol, opts.dataCol
+	if opts.dataCols != nil {
+		// The data columns are chosen below, once the header is known.
+		in.DataColumn = -1
+	}
+
+	if opts.header {
+		idColumn, dataColumn := opts.idColumn, opts.dataColumn
+		if typed, ok := reader.(schemaReader); ok {
+			// An Avro or Parquet file's schema says which fields are likely to
+			// be which.
+			id, data := typed.schemaColumns()
+			if idColumn == "" {
+				idColumn = id
+			}
+			if dataColumn == "" && opts.dataCols == nil {
+				dataColumn = data
+			}
+		}
+		header, err := in.ReadHeader(idColumn, dataColumn)
+		if err == io.EOF {
+			// An empty file has no rows to convert either.
+			return in, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		in.header = header
+	}
+
+	if opts.dataCols != nil {
+		cols, err := resolveDataColumns(opts.dataCols, in.header, in.IDColumn)
+		if err != nil {
+			return nil, err
+		}
+		in.dataCols = cols
+		in.DataColumn = cols[0].index
+	}
+	if opts.mimeColumn != "" {
+		col, err := resolveColumn(opts.mimeColumn, in.header)
+		if err != nil {
+			return nil, err
+		}
+		in.mimeCol = col
+	}
+	if opts.partColumn != "" {
+		col, err := resolveColumn(opts.partColumn, in.header)
+		if err != nil {
+			return nil, err
+		}
+		in.partCol = col
+	}
+	if opts.formatColumn != "" {
+		col, err := resolveColumn(opts.formatColumn, in.header)
+		if err != nil {
+			return nil, err
+		}
+		in.formatCol = col
+	}
+
+	in.metaAll = len(opts.metaCols) == 1 && opts.metaCols[0] == "all"
+	if !in.metaAll {
+		for _, column := range opts.metaCols {
+			col, err := resolveColumn(column, in.header)
+			if err != nil {
+				return nil, err
+			}
+			in.metaCols = append(in.metaCols, col)
+		}
+	}
+	return in, nil
+}
+
+// Returns the index of a column given by index or, if there's a header, by name.
+func resolveColumn(column string, header []string) (int, error) {
+	if index, err := strconv.Atoi(column); err == nil && index >= 0 {
+		return index, nil
+	}
+	if header == nil {
+		return 0, fmt.Errorf("column '%s' can only be chosen by name with -header", column)
+	}
+	return csvimage.HeaderColumn(header, column)
+}
+
+// Returns the media type a row declares in the -mime-column, or an empty string if
+// there isn't one.
+func (in *csvInput) mediaType(record []string) string {
+	if in.mimeCol < 0 || in.mimeCol >= len(record) {
+		return ""
+	}
+	return normalizeMediaType(record[in.mimeCol])
+}
+
+// Returns how many fields a record needs for its identifier and every data column.
+func (in *csvInput) width() int {
+	width := in.IDColumn + 1
+	if in.DataColumn >= width {
+		width = in.DataColumn + 1
+	}
+	for _, col := range in.dataCols {
+		if col.index >= width {
+			width = col.index + 1
+		}
+	}
+	return width
+}
+
+// Returns the values of a row's -meta-cols, keyed by their names in the header, or
+// by their indexes without one, or nil if there aren't any. With '-meta-cols all',
+// those are all the columns but the ones the row's images are made from.
+func (in *csvInput) meta(record []string) map[string]string {
+	cols := in.metaCols
+	if in.metaAll {
+		cols = nil
+		for i := range record {
+			if !in.usesColumn(i) {
+				cols = append(cols, i)
+			}
+		}
+	} else if len(cols) == 0 {
+		return nil
+	}
+
+	meta := make(map[string]string, len(cols))
+	for _, col := range cols {
+		if col < len(record) {
+			meta[in.columnName(col)] = record[col]
+		}
+	}
+	return meta
+}
+
+// Reports whether column `i` is one the images of a row are made from, rather
+// than metadata.
+func (in *csvInput) usesColumn(i int) bool {
+	if i == in.IDColumn || i == in.DataColumn || i == in.mimeCol || i == in.partCol || i == in.formatCol {
+		return true
+	}
+	for _, col := range in.dataCols {
+		if i == col.index {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of column `i` in the header, or its index if it has no name.
+func (in *csvInput) columnName(i int) string {
+	if i < len(in.header) && in.header[i] != "" {
+		return in.header[i]
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The value of -csv, which may be given more than once. The first path given
+// replaces the default rather than adding to it.
+type pathList struct {
+	paths []string
+	set   bool
+}
+
+func (l *pathList) String() string {
+	return strings.Join(l.paths, ", ")
+}
+
+func (l *pathList) Set(value string) error {
+	if !l.set {
+		l.paths, l.set = nil, true
+	}
+	l.paths = append(l.paths, value)
+	return nil
+}
+
+// Expands any glob patterns among the -csv paths, like 'exports/*.csv', into the
+// files they match, in lexical order, dropping files given more than once. Paths
+// that aren't patterns are kept as they are, whether or not they exist.
+func expandCSVPaths(paths []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		matches := []string{path}
+		if path != stdinPath && !isURL(path) && strings.ContainsAny(path, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				return nil, fmt.Errorf("invalid -csv pattern '%s': %s", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match -csv '%s'", path)
+			}
+		}
+
+		for _, match := range matches {
+			if !seen[filepath.Clean(match)] {
+				seen[filepath.Clean(match)] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// Returns the deepest directory that contains every one of `files`, as an absolute
+// path.
+func commonDir(files []string) (string, error) {
+	var common string
+	for i, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", err
+		}
+		dir := filepath.Dir(abs)
+		if i == 0 {
+			common = dir
+			continue
+		}
+		for !within(dir, common) {
+			common = filepath.Dir(common)
+		}
+	}
+	return common, nil
+}
+
+// Reports whether `path` is `dir` or beneath it, both being clean absolute paths.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
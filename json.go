@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A source of JSON objects for a jsonReader.
+type objectReader interface {
+	// Returns the field names and values of the next object, in the order they
+	// appear, or io.EOF after the last.
+	readObject() (fields, values []string, err error)
+	// Returns the offset in the input of the end of the object last read.
+	offset() int64
+}
+
+// Reads JSON objects as rows of fields, like csv.Reader. The first row is a header
+// of the first object's field names, and each object's values are returned in
+// that order, with any it's missing left empty and any others ignored. Strings are
+// unescaped, null is empty, and any other value is kept as JSON.
+type jsonReader struct {
+	objects objectReader
+
+	header  []string
+	columns map[string]int
+	// The first object, to be returned after the header.
+	first    []string
+	firstEnd int64
+	// The offset of the end of the row last returned.
+	end int64
+}
+
+func newJSONReader(objects objectReader) *jsonReader {
+	return &jsonReader{objects: objects}
+}
+
+func (j *jsonReader) Read() ([]string, error) {
+	if j.header == nil {
+		return j.readHeader()
+	}
+	if j.first != nil {
+		record := j.first
+		j.first, j.end = nil, j.firstEnd
+		return record, nil
+	}
+
+	fields, values, err := j.objects.readObject()
+	j.end = j.objects.offset()
+	if err != nil {
+		return nil, err
+	}
+	record := make([]string, len(j.header))
+	for i, field := range fields {
+		if col, ok := j.columns[field]; ok {
+			record[col] = values[i]
+		}
+	}
+	return record, nil
+}
+
+// Returns the offset of the end of the row last read, like
+// csv.Reader.InputOffset. The header ends where the first object starts, since
+// it's made from that object.
+func (j *jsonReader) InputOffset() int64 {
+	return j.end
+}
+
+// Reads the first object, returning its field names as the header and keeping its
+// values to be returned next.
+func (j *jsonReader) readHeader() ([]string, error) {
+	fields, values, err := j.objects.readObject()
+	if err != nil {
+		return nil, err
+	}
+
+	j.header, j.columns = fields, make(map[string]int, len(fields))
+	for i, field := range fields {
+		j.columns[field] = i
+	}
+	j.first, j.firstEnd = values, j.objects.offset()
+	return j.header, nil
+}
+
+// Returned by decodeObject for a value that isn't an object.
+var errNotObject = errors.New("expected a JSON object")
+
+// Reads an object from `dec`, returning its field names and values in the order
+// they appear. A field given more than once keeps its last value. Any other value
+// is read through, so that the decoder is left at whatever follows it, and
+// errNotObject is returned.
+func decodeObject(dec *json.Decoder) (fields, values []string, err error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != json.Delim('{') {
+		for depth := 0; t == json.Delim('[') || depth > 0; {
+			switch t {
+			case json.Delim('['), json.Delim('{'):
+				depth++
+			case json.Delim(']'), json.Delim('}'):
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+			if t, err = dec.Token(); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, errNotObject
+	}
+
+	seen := map[string]int{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		field := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		text, err := jsonField(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if i, ok := seen[field]; ok {
+			values[i] = text
+			continue
+		}
+		seen[field] = len(fields)
+		fields, values = append(fields, field), append(values, text)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return fields, values, nil
+}
+
+// Returns the text of a JSON value as a field: a string unescaped, null as an
+// empty string, and anything else as it's written.
+func jsonField(value json.RawMessage) (string, error) {
+	switch value[0] {
+	case '"':
+		if bytes.IndexByte(value, '\\') < 0 {
+			// The decoder has checked it, and there's nothing to unescape.
+			return string(value[1 : len(value)-1]), nil
+		}
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	case 'n':
+		return "", nil
+	default:
+		return string(value), nil
+	}
+}
+
+// Reads the objects of a JSON array for a jsonReader, a token at a time, so that
+// only one of them is ever held in memory, however big the array. An element that
+// isn't an object is returned as a *csv.ParseError, and reading carries on with
+// the next, but the array can't be read past a syntax error.
+type jsonArray struct {
+	dec     *json.Decoder
+	lines   *lineCounter
+	started bool
+	ended   bool
+}
+
+func newJSONArrayReader(r io.Reader) *jsonReader {
+	lines := &lineCounter{r: r, last: -1}
+	return newJSONReader(&jsonArray{dec: json.NewDecoder(lines), lines: lines})
+}
+
+func (a *jsonArray) offset() int64 {
+	return a.dec.InputOffset()
+}
+
+func (a *jsonArray) readObject() (fields, values []string, err error) {
+	if a.ended {
+		return nil, nil, io.EOF
+	}
+	if !a.started {
+		t, err := a.dec.Token()
+		if err != nil {
+			// An empty input is an empty array.
+			return nil, nil, err
+		}
+		if t != json.Delim('[') {
+			return nil, nil, errors.New("expected a JSON array of objects")
+		}
+		a.started = true
+	}
+
+	if !a.dec.More() {
+		if _, err := a.dec.Token(); err != nil {
+			return nil, nil, a.syntaxError(err)
+		}
+		if _, err := a.dec.Token(); err != io.EOF {
+			return nil, nil, errors.New("unexpected data after the JSON array")
+		}
+		a.ended = true
+		return nil, nil, io.EOF
+	}
+
+	start := a.dec.InputOffset() + separatorLength(a.dec)
+	a.lines.forget(start)
+	fields, values, err = decodeObject(a.dec)
+	if err == errNotObject {
+		line, column := a.lines.position(start)
+		return nil, nil, &csv.ParseError{StartLine: line, Line: line, Column: column, Err: err}
+	}
+	return fields, values, a.syntaxError(err)
+}
+
+// Returns how many of the bytes that `dec` has read ahead are the whitespace and
+// comma that come before the next array element.
+func separatorLength(dec *json.Decoder) int64 {
+	var n int64
+	buffered := dec.Buffered()
+	var b [64]byte
+	for {
+		m, _ := buffered.Read(b[:])
+		if m == 0 {
+			return n
+		}
+		for _, c := range b[:m] {
+			switch c {
+			case ' ', '\t', '\r', '\n', ',':
+				n++
+			default:
+				return n
+			}
+		}
+	}
+}
+
+// Describes an error reading the array with where it happened. The end of the
+// input partway through is reported as such, rather than as io.EOF, which would
+// look like the end of the array.
+func (a *jsonArray) syntaxError(err error) error {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return errors.New("the JSON array ends before it's closed")
+	case errors.As(err, &syntaxErr):
+		line, column := a.lines.position(syntaxErr.Offset - 1)
+		return fmt.Errorf("invalid JSON on line %d, column %d: %s", line, column, err)
+	default:
+		return err
+	}
+}
+
+// Counts the lines of what's read through it, so that an offset in what was read
+// can be given a line and column. Only the line breaks since the last offset
+// forgotten are kept.
+type lineCounter struct {
+	r    io.Reader
+	read int64
+	// The offsets of the line breaks that haven't been forgotten, and how many
+	// have been, the last of them at offset `last`.
+	breaks    []int64
+	forgotten int
+	last      int64
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i := 0; i < n; {
+		j := bytes.IndexByte(p[i:n], '\n')
+		if j < 0 {
+			break
+		}
+		c.breaks = append(c.breaks, c.read+int64(i+j))
+		i += j + 1
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// Forgets the line breaks before `offset`, which is never asked about again.
+func (c *lineCounter) forget(offset int64) {
+	i := sort.Search(len(c.breaks), func(i int) bool { return c.breaks[i] >= offset })
+	if i > 0 {
+		c.forgotten += i
+		c.last = c.breaks[i-1]
+		c.breaks = append(c.breaks[:0], c.breaks[i:]...)
+	}
+}
+
+// Returns the line and column of `offset`, counting from 1.
+func (c *lineCounter) position(offset int64) (line, column int) {
+	i := sort.Search(len(c.breaks), func(i int) bool { return c.breaks[i] >= offset })
+	last := c.last
+	if i > 0 {
+		last = c.breaks[i-1]
+	}
+	return c.forgotten + i + 1, int(offset - last)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Reads JSON Lines, one object per line, for a jsonReader. Blank lines are
+// skipped. A line that isn't a JSON object is returned as a *csv.ParseError, and
+// reading carries on with the next.
+type jsonLines struct {
+	r    *bufio.Reader
+	line []byte
+	// How many lines have been read, and the offset of the end of the last.
+	lines int
+	end   int64
+}
+
+func newJSONLReader(r io.Reader) *jsonReader {
+	return newJSONReader(&jsonLines{r: bufio.NewReader(r)})
+}
+
+func (l *jsonLines) offset() int64 {
+	return l.end
+}
+
+func (l *jsonLines) readObject() (fields, values []string, err error) {
+	for {
+		if err := l.readLine(); err != nil {
+			return nil, nil, err
+		}
+		if len(bytes.TrimSpace(l.line)) > 0 {
+			break
+		}
+	}
+	return decodeLine(l.line, l.lines)
+}
+
+// Reads `text` as a single JSON object, returning its field names and values, or
+// a *csv.ParseError on line `line` if it's anything else.
+func decodeLine(text []byte, line int) (fields, values []string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	fields, values, err = decodeObject(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return fields, values, nil
+		}
+		if err == nil {
+			err = errors.New("unexpected data after the object")
+		}
+	}
+
+	column := int(dec.InputOffset()) + 1
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		column = int(syntaxErr.Offset)
+	}
+	return nil, nil, &csv.ParseError{StartLine: line, Line: line, Column: column, Err: err}
+}
+
+// Reads the next line into l.line, without its line break. Lines are read a
+// buffer at a time, since one holding an image can be arbitrarily long.
+func (l *jsonLines) readLine() error {
+	l.line = l.line[:0]
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.line = append(l.line, chunk...)
+		l.end += int64(len(chunk))
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(l.line) > 0 {
+			// The last line needn't end with a line break.
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		l.lines++
+		l.line = bytes.TrimRight(l.line, "\r\n")
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Consumes the messages of a Kafka topic as a member of a consumer group, so that
+// every instance consuming with the same group shares its partitions.
+//
+// Kafka only remembers how far through each partition a group has read, not
+// which messages it's handled, so a partition's offset is only committed past
+// messages that have been acknowledged or rejected, in order. Kafka can't be
+// asked to deliver a single message again either, so one returned to be
+// delivered again is received again from here, before any more are fetched. It
+// holds back the commit of its partition, and with it of every message after it,
+// until it's handled, so once it's been returned kafkaRedeliveries times, or
+// kafkaMaxPending messages are waiting on it, consuming stops with an error,
+// leaving them all to be read again once restarted.
+type kafkaSource struct {
+	reader *kafka.Reader
+
+	// Held while committing, so that commits of a partition are made in order.
+	mu      sync.Mutex
+	offsets kafkaOffsets
+	// Messages returned to be delivered again, and the error to stop consuming
+	// with, if any. Either wakes a receive waiting for a message to be fetched.
+	redeliver []kafka.Message
+	err       error
+	wake      chan struct{}
+}
+
+// How many times a message may be returned to be delivered again, and how many
+// messages of a partition may wait to be committed behind one that hasn't been
+// handled, before consuming stops.
+const (
+	kafkaRedeliveries = 10
+	kafkaMaxPending   = 100000
+)
+
+// Connects to the brokers at `rawURL`, like 'kafka://host:9092,other:9092', and
+// starts consuming `topic` as a member of `group`, fetching up to `prefetch`
+// messages ahead.
+func openKafka(rawURL, topic, group string, prefetch int) (*kafkaSource, error) {
+	brokers := rawURL[len("kafka://"):]
+	if i := strings.IndexByte(brokers, '/'); i >= 0 {
+		brokers = brokers[:i]
+	}
+	if brokers == "" {
+		return nil, fmt.Errorf("invalid -queue '%s': must name the brokers, like kafka://host:9092", rawURL)
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:       strings.Split(brokers, ","),
+		GroupID:       group,
+		Topic:         topic,
+		QueueCapacity: prefetch,
+	})
+	return &kafkaSource{reader: reader, offsets: kafkaOffsets{}, wake: make(chan struct{}, 1)}, nil
+}
+
+func (k *kafkaSource) receive(ctx context.Context) (*message, error) {
+	for {
+		k.mu.Lock()
+		if k.err != nil {
+			err := k.err
+			k.mu.Unlock()
+			return nil, err
+		}
+		if len(k.redeliver) > 0 {
+			m := k.redeliver[0]
+			k.redeliver = k.redeliver[1:]
+			k.mu.Unlock()
+			return k.message(m), nil
+		}
+		k.mu.Unlock()
+
+		m, err := k.fetch(ctx)
+		if ctx.Err() != nil {
+			return nil, errWatchStopped
+		}
+		if errors.Is(err, errKafkaWoken) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		k.offsets.fetched(m)
+		err = k.offsets.check(m.Partition)
+		k.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return k.message(m), nil
+	}
+}
+
+var errKafkaWoken = errors.New("woken to receive a message returned for delivery")
+
+// Fetches the next message, or returns errKafkaWoken if a message is returned to
+// be delivered again, or consuming is stopped, while waiting for one.
+func (k *kafkaSource) fetch(ctx context.Context) (kafka.Message, error) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	woken := make(chan bool, 1)
+	go func() {
+		select {
+		case <-k.wake:
+			woken <- true
+			cancel()
+		case <-fetchCtx.Done():
+			woken <- false
+		}
+	}()
+
+	m, err := k.reader.FetchMessage(fetchCtx)
+	cancel()
+	if <-woken && err != nil && ctx.Err() == nil {
+		return m, errKafkaWoken
+	}
+	return m, err
+}
+
+func (k *kafkaSource) message(m kafka.Message) *message {
+	done := func() error { return k.done(m) }
+	return &message{
+		body:   m.Value,
+		ack:    done,
+		retry:  func() error { return k.retry(m) },
+		reject: done,
+	}
+}
+
+// Returns a message to be received again, or once it's been returned too many
+// times, stops consuming.
+func (k *kafkaSource) retry(m kafka.Message) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.offsets.retried(m); err != nil {
+		k.err = err
+	} else {
+		k.redeliver = append(k.redeliver, m)
+	}
+	select {
+	case k.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Records that a message has been handled, and commits its partition's offset as
+// far as it can be.
+func (k *kafkaSource) done(m kafka.Message) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if last, ok := k.offsets.finish(m); ok {
+		return k.reader.CommitMessages(context.Background(), last)
+	}
+	return nil
+}
+
+// Leaves the group. Messages that haven't been committed are read again by
+// whichever member takes over their partitions.
+func (k *kafkaSource) Close() error {
+	return k.reader.Close()
+}
+
+// The messages fetched from each partition of a topic that haven't been
+// committed, in order, and whether each has been handled.
+type kafkaOffsets map[int][]kafkaOffset
+
+type kafkaOffset struct {
+	offset int64
+	done   bool
+	// How many times the message has been returned to be delivered again.
+	retries int
+}
+
+// Records a message as fetched. One at or before a message already fetched from
+// its partition means the partition's being read again from its last commit,
+// after the group was rebalanced, so the messages fetched before are forgotten.
+func (o kafkaOffsets) fetched(m kafka.Message) {
+	pending := o[m.Partition]
+	if len(pending) > 0 && m.Offset <= pending[len(pending)-1].offset {
+		pending = nil
+	}
+	o[m.Partition] = append(pending, kafkaOffset{offset: m.Offset})
+}
+
+// Records a message as returned to be delivered again, or returns an error if it's
+// been returned more than kafkaRedeliveries times.
+func (o kafkaOffsets) retried(m kafka.Message) error {
+	i := o.find(m)
+	if i < 0 {
+		return nil
+	}
+	pending := o[m.Partition]
+	pending[i].retries++
+	if pending[i].retries > kafkaRedeliveries {
+		return fmt.Errorf("the message at offset %d of partition %d of '%s' still couldn't be converted after %d attempts; stopping, since its partition can't be committed past it", m.Offset, m.Partition, m.Topic, pending[i].retries)
+	}
+	return nil
+}
+
+// Returns the index of a message among those of its partition that haven't been
+// committed, which are in order of offset, or -1 if it isn't one of them.
+func (o kafkaOffsets) find(m kafka.Message) int {
+	pending := o[m.Partition]
+	i := sort.Search(len(pending), func(i int) bool { return pending[i].offset >= m.Offset })
+	if i < len(pending) && pending[i].offset == m.Offset {
+		return i
+	}
+	return -1
+}
+
+// Returns an error if more than kafkaMaxPending messages of a partition are
+// waiting to be committed behind one that hasn't been handled.
+func (o kafkaOffsets) check(partition int) error {
+	pending := o[partition]
+	if len(pending) <= kafkaMaxPending+1 {
+		return nil
+	}
+	return fmt.Errorf("%d messages of partition %d are waiting to be committed behind the one at offset %d, which hasn't been handled; stopping, to read them again once restarted", len(pending)-1, partition, pending[0].offset)
+}
+
+// Records a message as handled, and returns the last of the messages at the
+// start of its partition that have all been handled, whose offset can be
+// committed, if there are any.
+func (o kafkaOffsets) finish(m kafka.Message) (last kafka.Message, ok bool) {
+	pending := o[m.Partition]
+	if i := o.find(m); i >= 0 {
+		pending[i].done = true
+	}
+	n := 0
+	for n < len(pending) && pending[n].done {
+		n++
+	}
+	if n == 0 {
+		return kafka.Message{}, false
+	}
+	last = kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: pending[n-1].offset}
+	o[m.Partition] = pending[n:]
+	return last, true
+}
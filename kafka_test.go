@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaOffsets(t *testing.T) {
+	offsets := kafkaOffsets{}
+	message := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Topic: "photos", Partition: partition, Offset: offset}
+	}
+	for _, m := range []kafka.Message{message(0, 10), message(0, 11), message(0, 12), message(1, 5)} {
+		offsets.fetched(m)
+	}
+
+	// Nothing's committed past a message that hasn't been handled.
+	if _, ok := offsets.finish(message(0, 11)); ok {
+		t.Error("expected no commit while offset 10 is unhandled")
+	}
+	if last, ok := offsets.finish(message(0, 10)); !ok || last.Offset != 11 {
+		t.Errorf("expected offsets 10 and 11 to be committed, got %d", last.Offset)
+	}
+	// Partitions are committed separately.
+	if last, ok := offsets.finish(message(1, 5)); !ok || last.Partition != 1 || last.Offset != 5 {
+		t.Errorf("expected offset 5 of partition 1 to be committed, got %d of %d", last.Offset, last.Partition)
+	}
+
+	// A rebalance reads the partition again from its last commit, forgetting the
+	// messages fetched before.
+	offsets.fetched(message(0, 12))
+	offsets.fetched(message(0, 13))
+	if last, ok := offsets.finish(message(0, 12)); !ok || last.Offset != 12 {
+		t.Errorf("expected offset 12 to be committed, got %d", last.Offset)
+	}
+	if n := len(offsets[0]); n != 1 {
+		t.Errorf("expected only offset 13 to be pending, got %d offsets", n)
+	}
+}
+
+func TestKafkaOffsetsUnfinishedHead(t *testing.T) {
+	offsets := kafkaOffsets{}
+	head := kafka.Message{Topic: "photos", Partition: 0, Offset: 0}
+	offsets.fetched(head)
+
+	// Every message after the head is handled, but the head never is, so none can
+	// be committed, and they pile up behind it until there are too many.
+	for offset := int64(1); offset <= kafkaMaxPending; offset++ {
+		m := kafka.Message{Topic: "photos", Partition: 0, Offset: offset}
+		offsets.fetched(m)
+		if err := offsets.check(0); err != nil {
+			t.Fatalf("expected %d pending messages to be allowed, got %s", len(offsets[0]), err)
+		}
+		if _, ok := offsets.finish(m); ok {
+			t.Fatalf("expected no commit past the unhandled head, got one at offset %d", offset)
+		}
+	}
+	offsets.fetched(kafka.Message{Topic: "photos", Partition: 0, Offset: kafkaMaxPending + 1})
+	if err := offsets.check(0); err == nil || !strings.Contains(err.Error(), "offset 0") {
+		t.Errorf("expected an error naming the unhandled head, got %v", err)
+	}
+
+	// The head may only be returned to be delivered again so many times.
+	for i := 0; i < kafkaRedeliveries; i++ {
+		if err := offsets.retried(head); err != nil {
+			t.Fatalf("expected attempt %d to be allowed, got %s", i+1, err)
+		}
+	}
+	if err := offsets.retried(head); err == nil {
+		t.Error("expected an error once the head had been returned too many times")
+	}
+}
+
+func TestKafkaRedelivery(t *testing.T) {
+	k := &kafkaSource{offsets: kafkaOffsets{}, wake: make(chan struct{}, 1)}
+	head := kafka.Message{Topic: "photos", Partition: 0, Offset: 7, Value: []byte("a,data")}
+	k.offsets.fetched(head)
+
+	// A returned message is received again, without fetching another.
+	for i := 0; i < kafkaRedeliveries; i++ {
+		if err := k.retry(head); err != nil {
+			t.Fatal(err)
+		}
+		m, err := k.receive(context.Background())
+		if err != nil {
+			t.Fatalf("expected the message to be delivered again, got %s", err)
+		}
+		if string(m.body) != "a,data" {
+			t.Errorf("expected the returned message, got %q", m.body)
+		}
+	}
+
+	// Once it's been returned too many times, consuming stops.
+	if err := k.retry(head); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.receive(context.Background()); err == nil || !strings.Contains(err.Error(), "offset 7") {
+		t.Errorf("expected consuming to stop at offset 7, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The name of the CSV of malformed rows written to the output directory.
+const malformedName = "errors.csv"
+
+// Keeps the text a CSV reader has read since the end of the last row, so that a
+// row that can't be parsed can be reported as it appears in the file.
+type rawRecorder struct {
+	r   io.Reader
+	buf []byte
+	// The input offset of the start of buf.
+	start int64
+	// How much of the start of buf has been returned by next, and can be dropped.
+	done int
+}
+
+func (rr *rawRecorder) Read(p []byte) (int, error) {
+	if rr.done > 0 {
+		// Move what's been read of the next row to the start of the buffer, so that
+		// its space is reused rather than reallocated for every row.
+		rr.buf = append(rr.buf[:0], rr.buf[rr.done:]...)
+		rr.done = 0
+	}
+
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// Returns the text of the row that ends at input offset `end`, as reported by
+// csv.Reader.InputOffset, and forgets it. The text is only valid until the next
+// read.
+func (rr *rawRecorder) next(end int64) []byte {
+	n := int(end-rr.start) + rr.done
+	if n > len(rr.buf) {
+		n = len(rr.buf)
+	}
+	text := rr.buf[rr.done:n]
+	rr.done = n
+	rr.start = end
+	return text
+}
+
+// A CSV in the output directory of the rows that couldn't be parsed as CSV at all:
+// the row number, the line of the file it started on, the parse error, and the
+// row's text as it appears in the file. It's only created once there's a row to
+// add, and a nil log adds nothing.
+type malformedLog struct {
+	dir string
+	f   *os.File
+	w   *csv.Writer
+}
+
+func newMalformedLog(dir string) *malformedLog {
+	return &malformedLog{dir: dir}
+}
+
+// Adds a row to the log. Each is flushed straight away, like the manifest's.
+func (l *malformedLog) add(row int, err *csv.ParseError, raw []byte) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.f == nil {
+		f, err := os.Create(filepath.Join(l.dir, malformedName))
+		if err != nil {
+			return err
+		}
+		l.f, l.w = f, csv.NewWriter(f)
+		l.w.Write([]string{"row", "line", "error", "raw"})
+	}
+
+	text := strings.TrimRight(string(raw), "\r\n")
+	l.w.Write([]string{strconv.Itoa(row), strconv.Itoa(err.StartLine), err.Err.Error(), text})
+	l.w.Flush()
+	return l.w.Error()
+}
+
+func (l *malformedLog) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// The name of the manifest written to the output directory.
+const manifestName = "manifest.csv"
+
+// A CSV in the output directory listing every row processed: its identifier and
+// row number, the format it was decoded from, the file it was written to and its
+// size, the error if it couldn't be converted, and the identifier as it was in the
+// input if -strip-prefix shortened it.
+type manifest struct {
+	dir string
+	f   *os.File
+	w   *csv.Writer
+}
+
+// Creates or replaces the manifest in `dir`. When `appending`, as when resuming a
+// run, rows are added to the end of an existing manifest instead, so it still lists
+// the rows converted before.
+func createManifest(dir string, appending bool) (*manifest, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(filepath.Join(dir, manifestName), flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{dir: dir, f: f, w: csv.NewWriter(f)}
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		// Appending to a manifest that already has its header.
+		return m, nil
+	}
+	if err := m.write([]string{"id", "row", "result", "format", "file", "bytes", "error", "original_id"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Calls `fn` with each row of the manifest in `dir`, after its header, reporting
+// whether there was a manifest to read.
+func scanManifest(dir string, fn func(record []string)) (bool, error) {
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	if _, err := r.Read(); err != nil && err != io.EOF {
+		return false, fmt.Errorf("invalid manifest in '%s': %s", dir, err)
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("invalid manifest in '%s': %s", dir, err)
+		}
+		fn(record)
+	}
+}
+
+// Returns the identifiers of the images that the manifest in `dir` lists as
+// written, by any of the runs that added to it, or nil if there's no manifest.
+// Images written unchanged, as data of types that aren't images, count too.
+func readWritten(dir string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	found, err := scanManifest(dir, func(record []string) {
+		if len(record) > 2 && (record[2] == written.String() || record[2] == raw.String()) {
+			ids[record[0]] = true
+		}
+	})
+	if !found {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Returns the files that the manifest in `dir` lists, relative to it, keyed by
+// identifier, for -clean. A missing manifest lists none.
+func readManifestFiles(dir string) (map[string][]string, error) {
+	files := map[string][]string{}
+	_, err := scanManifest(dir, func(record []string) {
+		if len(record) > 4 && record[4] != "" {
+			files[record[0]] = append(files[record[0]], record[4])
+		}
+	})
+	return files, err
+}
+
+// Deletes the files in `dir` that were listed by its manifest, as returned by
+// readManifestFiles, for identifiers that aren't in `keep`, returning how many
+// were deleted. Files that are already gone, or that the manifest also lists for
+// an identifier being kept, are left alone, as is anything outside `dir`.
+func cleanOutput(dir string, files map[string][]string, keep map[string]bool) (int, error) {
+	kept := map[string]bool{}
+	for id, names := range files {
+		if keep[id] {
+			for _, name := range names {
+				kept[name] = true
+			}
+		}
+	}
+
+	deleted := 0
+	for id, names := range files {
+		if keep[id] {
+			continue
+		}
+		for _, name := range names {
+			path := filepath.FromSlash(name)
+			if kept[name] || !filepath.IsLocal(path) {
+				continue
+			}
+			err := os.Remove(filepath.Join(dir, path))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Adds a row to the manifest. Each is flushed straight away, so the manifest is
+// up to date even if the run is killed.
+func (m *manifest) add(ev *rowEvent) error {
+	file := ev.Output
+	if rel, err := filepath.Rel(m.dir, ev.Output); err == nil && ev.Output != "" {
+		file = filepath.ToSlash(rel)
+	}
+
+	var size string
+	if ev.Bytes > 0 {
+		size = strconv.Itoa(ev.Bytes)
+	}
+	return m.write([]string{ev.ID, strconv.Itoa(ev.Row), ev.Result, ev.Format, file, size, ev.Error, ev.OriginalID})
+}
+
+func (m *manifest) write(record []string) error {
+	m.w.Write(record)
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func (m *manifest) Close() error {
+	return m.f.Close()
+}
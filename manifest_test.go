@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestKeptWhenResuming(t *testing.T) {
+	for _, resume := range []string{"resume", "skip-existing"} {
+		opts := testOptions(t.TempDir())
+		path := writeTemp(t, "input.csv", numberedCSV(t, 3))
+		// A first run cut short after two rows.
+		opts.limit = 2
+		if err := convertFile(context.Background(), path, opts, newSummary()); err != nil {
+			t.Fatal(err)
+		}
+		opts.limit = 0
+		opts.resume = resume == "resume"
+		opts.skipExisting = resume == "skip-existing"
+		if err := convertFile(context.Background(), path, opts, newSummary()); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := csv.NewReader(bytes.NewReader(readOutput(t, opts, manifestName))).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		written := map[string]int{}
+		for _, record := range records[1:] {
+			if record[0] == "id" {
+				t.Fatalf("-%s: expected a single header", resume)
+			}
+			if record[2] == "written" {
+				written[record[0]]++
+			}
+		}
+		for _, id := range []string{"1", "2", "3"} {
+			if written[id] == 0 {
+				t.Errorf("-%s: expected the manifest to list row %s as written", resume, id)
+			}
+		}
+	}
+}
+
+func TestManifestReplacedByDefault(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	if _, err := convertCSV(t, numberedCSV(t, 2), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := convertCSV(t, "3,"+pngData(t)+"\n", opts); err != nil {
+		t.Fatal(err)
+	}
+	manifest := readManifest(t, opts)
+	if _, ok := manifest["1"]; ok || len(manifest) != 1 {
+		t.Errorf("expected only the last run's rows, got %v", manifest)
+	}
+}
+
+func TestResumeFromManifest(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	data := pngData(t)
+	// Row 2 can't be decoded, so it's dumped rather than written.
+	if _, err := convertCSV(t, "1,"+data+"\n2,bm90IGFuIGltYWdl\n3,"+data+"\n", opts); err != nil {
+		t.Fatal(err)
+	}
+	if result := readManifest(t, opts)["2"][2]; result == "written" {
+		t.Fatalf("expected row 2 not to be written, got %s", result)
+	}
+
+	// Rows 1 and 3 are skipped, row 2 is converted again, and row 4 is new.
+	opts.resume = true
+	stats, err := convertCSV(t, numberedCSV(t, 4), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 2 || stats.skipped != 2 {
+		t.Errorf("expected 2 rows written and 2 skipped, got %d and %d", stats.success, stats.skipped)
+	}
+	for _, id := range []string{"2", "4"} {
+		if result := readManifest(t, opts)[id][2]; result != "written" {
+			t.Errorf("expected row %s to be written, got %s", id, result)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	for _, clean := range []bool{false, true} {
+		// A run over every row, then one over a CSV that row 2 has gone from.
+		opts.clean = false
+		if _, err := convertCSV(t, numberedCSV(t, 3), opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(opts.outputDir, "unlisted.png"), pngBytes(t, testImage(4, 3)), 0666); err != nil {
+			t.Fatal(err)
+		}
+		opts.clean = clean
+		data := pngData(t)
+		if _, err := convertCSV(t, "1,"+data+"\n3,"+data+"\n", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "1.png,2.png,3.png,unlisted.png"
+		if clean {
+			// Only files the manifest lists are deleted.
+			want = "1.png,3.png,unlisted.png"
+		}
+		if got := strings.Join(outputImages(t, opts), ","); got != want {
+			t.Errorf("-clean=%t: expected %s, got %s", clean, want, got)
+		}
+	}
+}
+
+func TestCleanSkippedAfterUnreadRows(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	if _, err := convertCSV(t, numberedCSV(t, 3), opts); err != nil {
+		t.Fatal(err)
+	}
+	// Row 2 is malformed, so it might be the row whose image is 2.png.
+	opts.clean = true
+	data := pngData(t)
+	if _, err := convertCSV(t, "1,"+data+"\n2,\"unterminated\n", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(outputImages(t, opts), ","); got != "1.png,2.png,3.png" {
+		t.Errorf("expected nothing to be deleted, got %s", got)
+	}
+}
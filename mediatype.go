@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// File extensions for media types whose subtype isn't one already.
+var mediaTypeExtensions = map[string]string{
+	"image/svg+xml":            "svg",
+	"image/x-icon":             "ico",
+	"image/vnd.microsoft.icon": "ico",
+	"application/octet-stream": "bin",
+	"application/gzip":         "gz",
+}
+
+// Returns a media type, like the value of a Content-Type header, in lower case and
+// without any parameters.
+func normalizeMediaType(value string) string {
+	if i := strings.IndexByte(value, ';'); i >= 0 {
+		value = value[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// Returns the image format named by a media type, like png for image/png, or an
+// empty string if it doesn't name an image format.
+func mediaTypeFormat(mediaType string) string {
+	if !strings.HasPrefix(mediaType, "image/") {
+		return ""
+	}
+	format := strings.TrimPrefix(mediaType, "image/")
+	if format == "jpg" {
+		return "jpeg"
+	}
+	return format
+}
+
+// Reports whether data of a media type can be decoded as an image. An empty media
+// type is assumed to be one.
+func decodableMediaType(mediaType string) bool {
+	if mediaType == "" {
+		return true
+	}
+	_, ok := csvimage.NormalizeFormat(mediaTypeFormat(mediaType))
+	return ok
+}
+
+// Returns the file extension for data of a media type: its subtype, like pdf for
+// application/pdf, if that's a plausible extension, or bin otherwise.
+func mediaTypeExtension(mediaType string) string {
+	if ext, ok := mediaTypeExtensions[mediaType]; ok {
+		return ext
+	}
+
+	subtype := mediaType[strings.IndexByte(mediaType, '/')+1:]
+	if subtype == "" {
+		return "bin"
+	}
+	for _, c := range subtype {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "bin"
+		}
+	}
+	return subtype
+}
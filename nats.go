@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Consumes the messages of a JetStream stream, through a durable consumer, so
+// that every instance consuming with the same name shares its messages, and
+// those that weren't acknowledged are delivered again after a restart.
+type natsSource struct {
+	conn     *nats.Conn
+	messages jetstream.MessagesContext
+}
+
+// Connects to the NATS server at `rawURL`, creating the durable `consumer` of
+// `stream` if it doesn't already exist, and starts fetching up to `prefetch`
+// messages ahead.
+func openNATS(ctx context.Context, rawURL, stream, consumer string, prefetch int) (*natsSource, error) {
+	conn, err := nats.Connect(rawURL, nats.Name("csv-image"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to '%s': %s", dsnName(rawURL), err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:   consumer,
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to consume from stream '%s': %s", stream, err)
+	}
+	messages, err := c.Messages(jetstream.PullMaxMessages(prefetch))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &natsSource{conn: conn, messages: messages}, nil
+}
+
+func (n *natsSource) receive(ctx context.Context) (*message, error) {
+	msg, err := n.messages.Next(jetstream.NextContext(ctx))
+	if ctx.Err() != nil {
+		return nil, errWatchStopped
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message{body: msg.Data(), ack: msg.Ack, retry: msg.Nak, reject: msg.Term}, nil
+}
+
+// Stops fetching messages, and sends any acknowledgements still buffered before
+// disconnecting.
+func (n *natsSource) Close() error {
+	n.messages.Stop()
+	err := n.conn.Flush()
+	n.conn.Close()
+	return err
+}
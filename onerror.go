@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Returned when a conversion stops early because too many rows failed, according
+// to -on-error.
+var errTooManyFailures = errors.New("too many rows failed")
+
+// What to do when rows can't be converted, set with -on-error. Rows that are
+// dumped or counted as errors are failures, as for the exit status.
+type errorPolicy struct {
+	// Stop at the first failure.
+	fail bool
+	// Stop once more than this fraction of the rows processed have failed, if
+	// greater than zero.
+	threshold float64
+}
+
+// Parses an -on-error value: fail, skip, or threshold=N% (the % is optional).
+func parseErrorPolicy(value string) (errorPolicy, error) {
+	switch {
+	case value == "fail":
+		return errorPolicy{fail: true}, nil
+	case value == "skip":
+		return errorPolicy{}, nil
+	case strings.HasPrefix(value, "threshold="):
+		percent := strings.TrimSuffix(strings.TrimPrefix(value, "threshold="), "%")
+		n, err := strconv.ParseFloat(percent, 64)
+		if err != nil || n <= 0 || n >= 100 {
+			return errorPolicy{}, fmt.Errorf("invalid -on-error threshold '%s': must be a percentage between 0 and 100", percent)
+		}
+		return errorPolicy{threshold: n / 100}, nil
+	default:
+		return errorPolicy{}, fmt.Errorf("unsupported -on-error '%s': must be fail, skip, or threshold=N%%", value)
+	}
+}
+
+// Reports whether the failures so far mean the run should stop. A threshold isn't
+// applied until enough rows have been processed for a single failure not to
+// exceed it, so that one bad row at the start doesn't stop the run.
+func (p errorPolicy) exceeded(stats *summary) bool {
+	failures, total := stats.failures()
+	switch {
+	case p.fail:
+		return failures > 0
+	case p.threshold > 0:
+		return float64(total) >= math.Ceil(1/p.threshold) && float64(failures) > p.threshold*float64(total)
+	default:
+		return false
+	}
+}
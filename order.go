@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Prints the output for each row of a CSV, and adds the row to the manifest if
+// there is one. Rows are converted concurrently, so they're normally printed in
+// whatever order they finish; with -ordered each row is held back until every
+// earlier row has been printed, so that they appear in row order. Safe for
+// concurrent use.
+type rowPrinter struct {
+	ordered  bool
+	manifest *manifest
+
+	mu      sync.Mutex
+	next    int
+	pending map[int]rowOutput
+}
+
+// Everything there is to report about a row: the text to print, and the event to
+// add to the manifest, if any.
+type rowOutput struct {
+	text  string
+	event *rowEvent
+}
+
+func newRowPrinter(ordered bool, m *manifest) *rowPrinter {
+	return &rowPrinter{ordered: ordered, manifest: m, pending: map[int]rowOutput{}}
+}
+
+// Prints the output for the row with sequence number `seq`. Each sequence number,
+// counting up from zero, must be printed exactly once. `ev` may be nil for output
+// that doesn't describe a row's outcome.
+func (p *rowPrinter) print(seq int, text string, ev *rowEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.ordered {
+		p.emit(rowOutput{text, ev})
+		return
+	}
+
+	p.pending[seq] = rowOutput{text, ev}
+	for {
+		out, ok := p.pending[p.next]
+		if !ok {
+			return
+		}
+		p.emit(out)
+		delete(p.pending, p.next)
+		p.next++
+	}
+}
+
+func (p *rowPrinter) emit(out rowOutput) {
+	fmt.Print(out.text)
+	if p.manifest != nil && out.event != nil {
+		if err := p.manifest.add(out.event); err != nil {
+			log.Printf("Warning: failed to write to the manifest: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Formats whose files -pack includes, going by their magic numbers. Anything else,
+// like the '.txt' files rows are dumped to, is left out.
+var packFormats = map[string]bool{
+	"png":  true,
+	"jpeg": true,
+	"gif":  true,
+	"bmp":  true,
+	"tiff": true,
+	"webp": true,
+}
+
+// The formats named by file extensions with -normalize-ext, including synonyms,
+// like 'jpg' for jpeg.
+var extensionFormats = map[string]string{
+	"png":  "png",
+	"jpeg": "jpeg",
+	"jpg":  "jpeg",
+	"jpe":  "jpeg",
+	"jfif": "jpeg",
+	"gif":  "gif",
+	"bmp":  "bmp",
+	"dib":  "bmp",
+	"tiff": "tiff",
+	"tif":  "tiff",
+	"webp": "webp",
+}
+
+// Returns the format a file's extension names, for -normalize-ext, and whether
+// it's one we know. An unknown one is returned lowercased.
+func extensionFormat(path string) (format string, ok bool) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if format, ok := extensionFormats[ext]; ok {
+		return format, true
+	}
+	return ext, false
+}
+
+// Parses a -newer value: a duration before `now`, like '24h', or a date or time,
+// like '2024-05-01' (midnight in the local time zone) or '2024-05-01T12:00:00Z'.
+func parseNewer(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid -newer '%s': the duration must not be negative", value)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -newer '%s': expected a duration like '24h', a date like '2024-05-01', or a time like '2024-05-01T12:00:00Z'", value)
+}
+
+// Writes a CSV of '<identifier>,<data>' rows to `w` for every image file beneath
+// `dir`, in lexical order: the inverse of converting a CSV. Each identifier is the
+// file's path relative to `dir`, minus its extension, and its data is encoded
+// according to -encoding. Two files that would get the same identifier, like
+// 'a.png' and 'a.jpeg', are an error, since converting the CSV would write only
+// one of them.
+//
+// With -newer, files last modified at or before that time are left out. With
+// -normalize-ext, each row has a third column naming the format of its file's
+// extension, like 'jpeg' for 'photo.JPG', or the extension itself, lowercased,
+// if it's not a format's, unless -skip-unknown-ext leaves such files out.
+func packDir(dir string, w io.Writer, opts *options) error {
+	out := csv.NewWriter(w)
+	packed := map[string]string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if !opts.packNewer.IsZero() && !info.ModTime().After(opts.packNewer) {
+			return nil
+		}
+		format, known := extensionFormat(path)
+		if opts.normalizeExt && opts.skipUnknownExt && !known {
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !packFormats[csvimage.SniffMagic(contents)] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		id := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		if other, ok := packed[id]; ok {
+			return fmt.Errorf("'%s' and '%s' would both be packed as '%s'", other, path, id)
+		}
+		packed[id] = path
+
+		row := []string{id, csvimage.EncodeData(contents, opts.conv.Encoding)}
+		if opts.normalizeExt {
+			row = append(row, format)
+		}
+		return out.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
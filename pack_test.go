@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	png := pngBytes(t, testImage(4, 3))
+	writeTree(t, dir, map[string][]byte{
+		"a.png":          png,
+		"sub/x.png":      png,
+		"sub/deep/y.png": png,
+		"notes.txt":      []byte("not an image"),
+	})
+
+	opts := testOptions(t.TempDir())
+	var packed bytes.Buffer
+	if err := packDir(dir, &packed, opts); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := convertCSV(t, packed.String(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 3 || stats.errors != 0 {
+		t.Fatalf("expected every packed image to be written, got %s", stats)
+	}
+	for _, name := range []string{"a.png", "sub/x.png", "sub/deep/y.png"} {
+		if !bytes.Equal(readOutput(t, opts, filepath.FromSlash(name)), png) {
+			t.Errorf("expected %s to come back unchanged", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(opts.outputDir, "notes.txt")); err == nil {
+		t.Error("expected files that aren't images to be left out")
+	}
+}
+
+func TestPackRejectsDuplicateIdentifiers(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"a.png":  pngBytes(t, testImage(4, 3)),
+		"a.jpeg": jpegBytes(t, testImage(4, 3)),
+	})
+
+	err := packDir(dir, &bytes.Buffer{}, testOptions(t.TempDir()))
+	if err == nil || !strings.Contains(err.Error(), "would both be packed as 'a'") {
+		t.Fatalf("expected duplicate identifiers to be an error, got %v", err)
+	}
+}
+
+func TestPackNewer(t *testing.T) {
+	dir := t.TempDir()
+	png := pngBytes(t, testImage(4, 3))
+	writeTree(t, dir, map[string][]byte{"old.png": png, "sub/recent.png": png, "new.png": png})
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.png": 72 * time.Hour, "sub/recent.png": 2 * time.Hour, "new.png": 0} {
+		modified := now.Add(-age)
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		newer string
+		want  string
+	}{
+		{"", "new,old,sub/recent"},
+		{"24h", "new,sub/recent"},
+		{"1h", "new"},
+		{now.Add(-48 * time.Hour).Format("2006-01-02T15:04:05Z07:00"), "new,sub/recent"},
+	} {
+		opts := testOptions(t.TempDir())
+		if test.newer != "" {
+			var err error
+			if opts.packNewer, err = parseNewer(test.newer, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var packed bytes.Buffer
+		if err := packDir(dir, &packed, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(packedIDs(t, packed.String()), ","); got != test.want {
+			t.Errorf("-newer %q: expected %s, got %s", test.newer, test.want, got)
+		}
+	}
+}
+
+func TestParseNewer(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"36h":                  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"2024-05-01T06:30:00Z": time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC),
+		"2024-05-01":           time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+	} {
+		got, err := parseNewer(value, now)
+		if err != nil {
+			t.Errorf("%s: %s", value, err)
+		} else if !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s", value, want, got)
+		}
+	}
+	for _, value := range []string{"yesterday", "-1h", "2024-13-01"} {
+		if _, err := parseNewer(value, now); err == nil {
+			t.Errorf("expected '%s' to be invalid", value)
+		}
+	}
+}
+
+// Returns the identifiers of the rows of a packed CSV, in order.
+func packedIDs(t *testing.T, packed string) []string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(packed)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record[0])
+	}
+	return ids
+}
+
+func TestPackNormalizeExt(t *testing.T) {
+	dir := t.TempDir()
+	png := pngBytes(t, testImage(4, 3))
+	writeTree(t, dir, map[string][]byte{"a.JPG": png, "b.Jpeg": png, "c.jpe": png, "d.PNG": png, "e.img": png})
+
+	for _, test := range []struct {
+		skipUnknown bool
+		want        string
+	}{
+		{false, "a:jpeg,b:jpeg,c:jpeg,d:png,e:img"},
+		{true, "a:jpeg,b:jpeg,c:jpeg,d:png"},
+	} {
+		opts := testOptions(t.TempDir())
+		opts.normalizeExt, opts.skipUnknownExt = true, test.skipUnknown
+		var packed bytes.Buffer
+		if err := packDir(dir, &packed, opts); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&packed).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, record := range records {
+			if len(record) != 3 {
+				t.Fatalf("expected 3 columns, got %d", len(record))
+			}
+			got = append(got, record[0]+":"+record[2])
+		}
+		if strings.Join(got, ",") != test.want {
+			t.Errorf("-skip-unknown-ext=%t: expected %s, got %s", test.skipUnknown, test.want, strings.Join(got, ","))
+		}
+	}
+}
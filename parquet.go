@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// Reads the rows of a Parquet file, like csv.Reader. The first row is a header of
+// the columns of the file's schema, and each row's values are returned in that
+// order, read a page at a time, so that memory use doesn't grow with the size of
+// the file. Only flat schemas can be read: a column that's nested in a group, or
+// repeated, has no single value to put in a row.
+//
+// Values are read as text: null is empty, dates and timestamps are in RFC 3339
+// format, and decimals are scaled. Binary columns, which aren't annotated as
+// strings, are encoded according to -encoding, so that images stored as bytes are
+// converted as they are. The file must be closed once the reader is no longer
+// needed.
+type parquetReader struct {
+	pr       *reader.ParquetReader
+	file     source.ParquetFile
+	encoding string
+	header   []string
+	columns  []*parquet.SchemaElement
+	// The file the input was copied to, which is removed once it's closed.
+	path string
+	// The number of rows in the file, and how many have been read.
+	rows, row int64
+	// Whether the header's been returned.
+	started bool
+}
+
+// Starts reading the Parquet file read from `r`. A Parquet file's metadata is at
+// its end, so the input is first copied to a temporary file, to be read from
+// there in any order.
+func newParquetReader(r io.Reader, encoding string) (*parquetReader, error) {
+	f, err := ioutil.TempFile("", "csv-image-*.parquet")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	p := &parquetReader{encoding: encoding, path: f.Name()}
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	if p.file, err = openParquetFile(p.path); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if p.pr, err = reader.NewParquetColumnReader(p.file, 1); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to read the Parquet file: %s", err)
+	}
+	p.rows = p.pr.GetNumRows()
+
+	// The first element is the root of the schema, and the rest its columns.
+	schema := p.pr.SchemaHandler
+	for i, element := range schema.SchemaElements[1:] {
+		name := schema.GetExName(i + 1)
+		if element.GetNumChildren() > 0 || element.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+			p.Close()
+			return nil, fmt.Errorf("the Parquet file's column '%s' is nested or repeated, which isn't supported", name)
+		}
+		p.header = append(p.header, name)
+		p.columns = append(p.columns, element)
+	}
+	return p, nil
+}
+
+// Reports whether a column holds text, rather than binary data, which byte arrays
+// are unless they're annotated as strings.
+func parquetText(column *parquet.SchemaElement) bool {
+	if logical := column.GetLogicalType(); logical != nil {
+		return logical.IsSetSTRING() || logical.IsSetENUM() || logical.IsSetJSON()
+	}
+	if !column.IsSetConvertedType() {
+		return false
+	}
+	switch column.GetConvertedType() {
+	case parquet.ConvertedType_UTF8, parquet.ConvertedType_ENUM, parquet.ConvertedType_JSON:
+		return true
+	}
+	return false
+}
+
+// Returns the names of the first text column and the first binary column, if there
+// are any, to serve as the identifier and data columns when they aren't given.
+func (p *parquetReader) schemaColumns() (id, data string) {
+	for i, column := range p.columns {
+		switch column.GetType() {
+		case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		default:
+			continue
+		}
+		if parquetText(column) {
+			if id == "" {
+				id = p.header[i]
+			}
+		} else if data == "" && !column.IsSetConvertedType() {
+			data = p.header[i]
+		}
+	}
+	return id, data
+}
+
+func (p *parquetReader) Read() ([]string, error) {
+	if !p.started {
+		p.started = true
+		return p.header, nil
+	}
+	if p.row >= p.rows {
+		return nil, io.EOF
+	}
+	p.row++
+
+	record := make([]string, len(p.columns))
+	for i, column := range p.columns {
+		values, _, _, err := p.pr.ReadColumnByIndex(int64(i), 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("failed to read row %d of the Parquet file's column '%s'", p.row, p.header[i])
+		}
+		record[i] = p.field(column, values[0])
+	}
+	return record, nil
+}
+
+// Returns a value of a column as text.
+func (p *parquetReader) field(column *parquet.SchemaElement, value interface{}) string {
+	logical := column.GetLogicalType()
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		switch {
+		case column.GetConvertedType() == parquet.ConvertedType_DATE:
+			return time.Unix(int64(v)*24*60*60, 0).UTC().Format("2006-01-02")
+		case column.GetConvertedType() == parquet.ConvertedType_DECIMAL:
+			return types.DECIMAL_INT_ToString(int64(v), int(column.GetPrecision()), int(column.GetScale()))
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		switch {
+		case column.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return time.Unix(0, v*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+		case column.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MICROS:
+			return time.Unix(0, v*int64(time.Microsecond)).UTC().Format(time.RFC3339Nano)
+		case logical != nil && logical.IsSetTIMESTAMP() && logical.GetTIMESTAMP().GetUnit().IsSetNANOS():
+			return time.Unix(0, v).UTC().Format(time.RFC3339Nano)
+		case column.GetConvertedType() == parquet.ConvertedType_DECIMAL:
+			return types.DECIMAL_INT_ToString(v, int(column.GetPrecision()), int(column.GetScale()))
+		}
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		// Byte arrays are read as strings, whatever they hold.
+		switch {
+		case column.GetType() == parquet.Type_INT96:
+			return types.INT96ToTime(v).UTC().Format(time.RFC3339Nano)
+		case column.GetConvertedType() == parquet.ConvertedType_DECIMAL:
+			return types.DECIMAL_BYTE_ARRAY_ToString([]byte(v), int(column.GetPrecision()), int(column.GetScale()))
+		case parquetText(column):
+			return v
+		}
+		return csvimage.EncodeData([]byte(v), p.encoding)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// A local file for the Parquet reader, which opens it again for each column, to
+// read them side by side.
+type parquetFile struct {
+	*os.File
+}
+
+func openParquetFile(path string) (source.ParquetFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return parquetFile{f}, nil
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	return openParquetFile(name)
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("can't create '%s': the Parquet file is only read", name)
+}
+
+// A Parquet file's rows are stored a column at a time, so there's no text of them
+// to point to, and none to record either.
+func (p *parquetReader) InputOffset() int64 {
+	return 0
+}
+
+func (p *parquetReader) Close() error {
+	var err error
+	if p.pr != nil {
+		p.pr.ReadStop()
+	}
+	if p.file != nil {
+		err = p.file.Close()
+	}
+	if removeErr := os.Remove(p.path); err == nil {
+		err = removeErr
+	}
+	return err
+}
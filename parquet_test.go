@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type parquetPhoto struct {
+	ID    string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Data  string `parquet:"name=data, type=BYTE_ARRAY"`
+	Size  int32  `parquet:"name=size, type=INT32"`
+	Taken *int64 `parquet:"name=taken, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+}
+
+// Returns a Parquet file of `photos`.
+func parquetBytes(t testing.TB, photos ...parquetPhoto) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := writer.NewParquetWriterFromWriter(&buf, new(parquetPhoto), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, photo := range photos {
+		if err := w.Write(photo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetReader(t *testing.T) {
+	taken := int64(1700000000123)
+	contents := parquetBytes(t,
+		parquetPhoto{ID: "a", Data: "\x00\xff", Size: 2, Taken: &taken},
+		parquetPhoto{ID: "b", Data: "", Size: 0},
+	)
+	r, err := newParquetReader(bytes.NewReader(contents), "base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if id, data := r.schemaColumns(); id != "id" || data != "data" {
+		t.Errorf("expected the id and data columns to be found, got '%s' and '%s'", id, data)
+	}
+	want := [][]string{
+		{"id", "data", "size", "taken"},
+		{"a", "AP8=", "2", "2023-11-14T22:13:20.123Z"},
+		{"b", "", "0", ""},
+	}
+	for _, row := range want {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(record, row) {
+			t.Errorf("expected %q, got %q", row, record)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected the end of the file, got %v", err)
+	}
+}
+
+func TestConvertParquet(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.inputFormat = "parquet"
+	opts.header = true
+	original := pngBytes(t, testImage(4, 3))
+
+	stats, err := convertCSV(t, string(parquetBytes(t, parquetPhoto{ID: "a", Data: string(original)})), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 1 {
+		t.Fatalf("expected the image to be written, got %s", stats)
+	}
+	if !bytes.Equal(readOutput(t, opts, "a.png"), original) {
+		t.Error("the image written isn't the original")
+	}
+}
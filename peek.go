@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Fields longer than this are truncated when previewing rows.
+const previewFieldLength = 40
+
+// Prints the first `n` rows of a CSV, marking the columns that will be used as the
+// identifier and data, so the column layout can be checked before converting.
+func previewRows(reader recordReader, n int, w io.Writer, opts *options) error {
+	in, err := newCSVSource(reader, opts)
+	if err != nil {
+		return err
+	}
+	if in.header != nil {
+		fmt.Fprintf(w, "Header: %s\n", strings.Join(in.header, ", "))
+	}
+	labels := map[int]string{in.IDColumn: " (id)", in.DataColumn: " (data)"}
+	for _, col := range in.dataCols {
+		labels[col.index] = fmt.Sprintf(" (data, _%s)", col.suffix)
+	}
+
+	for row := 1; row <= n; row++ {
+		// Rows too short to convert are shown all the same, since they're what
+		// previewing is meant to catch.
+		_, _, err := in.Next()
+		if err == io.EOF {
+			break
+		}
+		if _, short := err.(*csvimage.ShortRowError); err != nil && !short {
+			return err
+		}
+
+		fmt.Fprintf(w, "Row %d:\n", row)
+		for i, field := range in.Fields() {
+			label, ok := labels[i]
+			if !ok && i == in.formatCol {
+				label = " (format)"
+			}
+			fmt.Fprintf(w, "  %d%s: %s\n", i, label, truncateField(field))
+		}
+	}
+	return nil
+}
+
+// Shortens a field for display, noting its full length if it was truncated.
+func truncateField(field string) string {
+	if len(field) <= previewFieldLength {
+		return field
+	}
+	return fmt.Sprintf("%s... (%d characters)", field[:previewFieldLength], len(field))
+}
+
+// Counts the rows of the CSV file at `path` without decoding any of their data.
+// The file is streamed rather than read into memory, so this is cheap even for
+// very large files. Malformed rows are counted, as converting skips them and carries
+// on rather than stopping.
+func countRows(path string, opts *options) (int, error) {
+	reader, file, err := parseCSV(path, opts, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if csvReader, ok := reader.(*csv.Reader); ok {
+		csvReader.ReuseRecord = true
+	}
+
+	rows := 0
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			if opts.header && rows > 0 {
+				rows--
+			}
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		var chunkErr *chunkError
+		var largeErr *fieldTooLargeError
+		if err != nil && !errors.As(err, &parseErr) && !errors.As(err, &chunkErr) && !errors.As(err, &largeErr) {
+			return rows, err
+		}
+		rows++
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPreviewRows(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.formatColumn = "2"
+	long := strings.Repeat("x", previewFieldLength+10)
+	path := writeTemp(t, "input.csv", "a,"+long+",png\nb,short,jpeg\nc,unseen,png\n")
+
+	reader, file, err := parseCSV(path, opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	if err := previewRows(reader, 2, &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Row 1:\n" +
+		"  0 (id): a\n" +
+		"  1 (data): " + long[:previewFieldLength] + "... (50 characters)\n" +
+		"  2 (format): png\n" +
+		"Row 2:\n" +
+		"  0 (id): b\n" +
+		"  1 (data): short\n" +
+		"  2 (format): jpeg\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	png := pngData(t)
+	tests := []struct {
+		name   string
+		header bool
+		csv    string
+	}{
+		{"plain", false, "a," + png + "\nb," + png + "\n"},
+		{"header", true, "id,data\na," + png + "\nb," + png + "\n"},
+		{"malformed row", false, "a," + png + "\nb,\"unterminated\"x\nc," + png + "\n"},
+		{"short row", false, "a," + png + "\nb\nc," + png + "\n"},
+	}
+
+	for _, test := range tests {
+		opts := testOptions(t.TempDir())
+		opts.header = test.header
+		path := writeTemp(t, "input.csv", test.csv)
+
+		count, err := countRows(path, opts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		stats := newSummary()
+		if err := convertFile(context.Background(), path, opts, stats); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if converted := stats.total + stats.skipped; count != converted {
+			t.Errorf("%s: counted %d rows, but converting saw %d", test.name, count, converted)
+		}
+	}
+}
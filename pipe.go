@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Converts a single encoded image, rather than a CSV of them, and writes the image
+// to `w`. This makes the tool usable as a filter in a shell pipeline. The encoded
+// data is `data`, or read from `r` if that's empty.
+func pipeImage(data string, r io.Reader, w io.Writer, opts *options) error {
+	if data == "" {
+		input, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		data = string(input)
+	}
+
+	img, format, err := opts.conv.Decode(strings.TrimSpace(data))
+	if err != nil {
+		return err
+	}
+	if opts.conv.Format != "" {
+		format = opts.conv.Format
+	}
+
+	// Encode to a buffer first, so nothing is written if encoding fails.
+	var buf bytes.Buffer
+	if err := opts.conv.Encode(&buf, opts.conv.Transform(img), format); err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestPipeImage(t *testing.T) {
+	for _, format := range []string{"", "jpeg"} {
+		opts := testOptions(t.TempDir())
+		opts.conv.Format = format
+
+		var out bytes.Buffer
+		if err := pipeImage("", strings.NewReader(pngData(t)+"\n"), &out, opts); err != nil {
+			t.Fatal(err)
+		}
+		img, decoded, err := image.Decode(&out)
+		if err != nil {
+			t.Fatalf("-format %q: the output isn't an image: %s", format, err)
+		}
+		want := format
+		if want == "" {
+			want = "png"
+		}
+		if decoded != want {
+			t.Errorf("-format %q: expected a %s, got a %s", format, want, decoded)
+		}
+		if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 3 {
+			t.Errorf("-format %q: expected a 4x3 image, got %dx%d", format, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestPipeImageRejectsBadData(t *testing.T) {
+	var out bytes.Buffer
+	if err := pipeImage("bm90IGFuIGltYWdl", nil, &out, testOptions(t.TempDir())); err == nil {
+		t.Fatal("expected an error for data that isn't an image")
+	}
+	if out.Len() > 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", out.Len())
+	}
+}
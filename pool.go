@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffers larger than this aren't returned to the pool, so that one huge image
+// doesn't pin its memory for the rest of the run.
+const maxPooledBuffer = 16 << 20
+
+// Buffers for encoded images, reused across rows to cut down on allocations.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// Returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// Returns a buffer to the pool once it's no longer needed.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Compares the allocations of encoding many small images with buffers from the
+// pool and with a new buffer for each, as the workers did before.
+func BenchmarkEncodeBuffer(b *testing.B) {
+	conv := &csvimage.Converter{Format: "jpeg"}
+	rec := csvimage.Record{ID: "a", Data: base64.StdEncoding.EncodeToString(pngBytes(b, noiseImage(64, 64)))}
+
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				buf := getBuffer()
+				if _, err := conv.Convert(rec, buf); err != nil {
+					b.Fatal(err)
+				}
+				putBuffer(buf)
+			}
+		})
+	})
+	b.Run("no-pool", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				buf := new(bytes.Buffer)
+				if _, err := conv.Convert(rec, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestBufferPoolReusesBuffers(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("leftover")
+	putBuffer(buf)
+	if again := getBuffer(); again.Len() != 0 {
+		t.Errorf("expected an empty buffer from the pool, got %q", again.String())
+	}
+
+	huge := getBuffer()
+	huge.Grow(maxPooledBuffer + 1)
+	putBuffer(huge)
+	for i := 0; i < 10; i++ {
+		if getBuffer() == huge {
+			t.Fatal("expected a buffer over the limit not to be pooled")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Describes data that couldn't be decoded as an image, given a reader of it as it
+// decodes: how many bytes it decodes to, hex dumps of the first and last `n` of
+// them, and the format its magic number suggests.
+func errorPreview(data io.Reader, n int) string {
+	decoded, err := ioutil.ReadAll(data)
+
+	var preview string
+	if err != nil {
+		preview = fmt.Sprintf("Decoded %d bytes before failing: %s\n", len(decoded), err)
+	} else {
+		preview = fmt.Sprintf("Decoded %d bytes\n", len(decoded))
+	}
+
+	head := decoded
+	if len(head) > n {
+		head = head[:n]
+	}
+	preview = preview + fmt.Sprintf("First %d bytes: %s\n", len(head), hex.EncodeToString(head))
+
+	if len(decoded) > n {
+		tail := decoded[len(decoded)-n:]
+		preview = preview + fmt.Sprintf("Last %d bytes: %s\n", len(tail), hex.EncodeToString(tail))
+	}
+
+	if magic := csvimage.SniffMagic(decoded); magic != "" {
+		preview = preview + fmt.Sprintf("Magic number suggests: %s\n", magic)
+	} else {
+		preview = preview + "Magic number not recognized\n"
+	}
+	return preview
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+func TestErrorPreview(t *testing.T) {
+	// A truncated PDF, which decodes fine but isn't an image.
+	data := base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\nand then some more bytes"))
+	preview := errorPreview(csvimage.NewDecoder(data, "base64"), 4)
+
+	for _, want := range []string{
+		"Decoded 33 bytes",
+		"First 4 bytes: 25504446",
+		"Last 4 bytes: 79746573",
+		"Magic number suggests: pdf",
+	} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("expected the preview to contain %q, got\n%s", want, preview)
+		}
+	}
+}
+
+func TestErrorPreviewOfInvalidData(t *testing.T) {
+	preview := errorPreview(csvimage.NewDecoder("iVBO!!!!", "base64"), 8)
+	for _, want := range []string{"before failing", "First 3 bytes: 89504e", "Magic number not recognized"} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("expected the preview to contain %q, got\n%s", want, preview)
+		}
+	}
+}
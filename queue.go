@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// A message consumed from a -queue, holding a row to convert.
+type message struct {
+	body []byte
+	// Acknowledges the message, so that it's not delivered again.
+	ack func() error
+	// Returns the message to the queue, to be delivered again.
+	retry func() error
+	// Refuses the message as one that can never be converted, so that it's not
+	// delivered again, but can be dead-lettered by the queue.
+	reject func() error
+}
+
+// A source of messages, like a NATS JetStream consumer, an AMQP queue or a Kafka
+// topic.
+type messageSource interface {
+	// Returns the next message, waiting for one to arrive, or errWatchStopped once
+	// `ctx` is cancelled.
+	receive(ctx context.Context) (*message, error)
+	Close() error
+}
+
+// Returns the scheme of a -queue URL in lower case, if it's one we can consume
+// from, or an empty string.
+func queueScheme(rawURL string) string {
+	i := strings.Index(rawURL, "://")
+	if i < 0 {
+		return ""
+	}
+	switch scheme := strings.ToLower(rawURL[:i]); scheme {
+	case "nats", "tls", "amqp", "amqps", "kafka":
+		return scheme
+	default:
+		return ""
+	}
+}
+
+// Reads the messages consumed from a -queue as rows, like csv.Reader, until its
+// context is cancelled. Each message is a row of the CSV, or with -input-format
+// json, an object whose fields are named as if by a -header.
+//
+// Messages are settled once their rows have finished: acknowledged once their
+// images have been written (or dumped, or the row skipped), returned to the
+// queue to be delivered again if one of them couldn't be written, and rejected if
+// the row can't be converted at all, like a malformed one. Safe for concurrent
+// use by workers settling rows while rows are read, and a nil reader settles
+// nothing.
+type queueReader struct {
+	ctx       context.Context
+	source    messageSource
+	delimiter rune
+	lenient   bool
+	// With -input-format json, the reader of the messages' objects, which this
+	// reader is the objectReader of, and whether an object has been read yet.
+	objects *jsonReader
+	started bool
+
+	mu sync.Mutex
+	// The messages of rows that haven't finished, by row number, counting from
+	// 1, and how many messages have been read as rows.
+	pending map[int]*pendingMessage
+	rows    int
+}
+
+// A message whose row hasn't finished, and what's happened to its images so far.
+type pendingMessage struct {
+	msg      *message
+	failed   bool
+	rejected bool
+}
+
+// Connects to the queue at the -queue URL, to read its messages until `ctx` is
+// cancelled.
+func openQueue(ctx context.Context, opts *options) (*queueReader, error) {
+	// Enough messages are fetched ahead to keep every worker busy.
+	prefetch := 4 * opts.workers
+	var source messageSource
+	var err error
+	switch queueScheme(opts.queue) {
+	case "nats", "tls":
+		source, err = openNATS(ctx, opts.queue, opts.queueName, opts.queueConsumer, prefetch)
+	case "amqp", "amqps":
+		source, err = openAMQP(opts.queue, opts.queueName, prefetch)
+	case "kafka":
+		source, err = openKafka(opts.queue, opts.queueName, opts.queueConsumer, prefetch)
+	default:
+		err = errors.New("invalid -queue: must be a nats://, tls://, amqp://, amqps:// or kafka:// URL")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := &queueReader{ctx: ctx, source: source, delimiter: opts.delimiter, lenient: opts.lenient, pending: map[int]*pendingMessage{}}
+	if opts.inputFormat != "csv" {
+		q.objects = newJSONReader(q)
+	}
+	return q, nil
+}
+
+func (q *queueReader) Read() ([]string, error) {
+	if q.objects != nil {
+		return q.objects.Read()
+	}
+
+	m, err := q.source.receive(q.ctx)
+	if err != nil {
+		return nil, err
+	}
+	q.add(m)
+
+	r := csv.NewReader(bytes.NewReader(m.body))
+	r.Comma, r.LazyQuotes, r.FieldsPerRecord = q.delimiter, q.lenient, -1
+	record, err := r.Read()
+	if err == io.EOF {
+		return nil, &csv.ParseError{StartLine: 1, Line: 1, Column: 1, Err: errors.New("empty message")}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Read(); err != io.EOF {
+		// Only the first row would be acknowledged along with the rest.
+		return nil, &csv.ParseError{StartLine: 2, Line: 2, Column: 1, Err: errors.New("expected a single row per message")}
+	}
+	return record, nil
+}
+
+// Reads the next message as a JSON object, for q.objects. Until an object has
+// been read for the header, messages that aren't objects are rejected with a
+// warning, since there's no row to report them as yet.
+func (q *queueReader) readObject() (fields, values []string, err error) {
+	for {
+		m, err := q.source.receive(q.ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields, values, err = decodeLine(m.body, 1)
+		if err != nil && !q.started {
+			log.Printf("Warning: rejecting a message before the first object: %s\n", err)
+			if err := m.reject(); err != nil {
+				log.Printf("Warning: failed to reject the message: %s\n", err)
+			}
+			continue
+		}
+		q.started = true
+		q.add(m)
+		return fields, values, err
+	}
+}
+
+// There's no text of the messages to point to, so there's none to record for
+// them either.
+func (q *queueReader) offset() int64 {
+	return 0
+}
+
+func (q *queueReader) InputOffset() int64 {
+	return 0
+}
+
+// Records a message as the next row.
+func (q *queueReader) add(m *message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rows++
+	q.pending[q.rows] = &pendingMessage{msg: m}
+}
+
+// Returns how many messages have been read as rows.
+func (q *queueReader) received() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows
+}
+
+// Records that one of a row's images couldn't be written, so that its message is
+// returned to the queue once the row has finished.
+func (q *queueReader) fail(row int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if p, ok := q.pending[row]; ok {
+		p.failed = true
+	}
+}
+
+// Records that a row can't be converted at all, so that its message is rejected
+// once the row has finished.
+func (q *queueReader) reject(row int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if p, ok := q.pending[row]; ok {
+		p.rejected = true
+	}
+}
+
+// Settles the message of a row that's finished, according to what happened to
+// it.
+func (q *queueReader) complete(row int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	p, ok := q.pending[row]
+	delete(q.pending, row)
+	q.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	settle, action := p.msg.ack, "acknowledge"
+	switch {
+	case p.rejected:
+		settle, action = p.msg.reject, "reject"
+	case p.failed:
+		settle, action = p.msg.retry, "return"
+	}
+	if err := settle(); err != nil {
+		log.Printf("Warning: failed to %s the message of row %d: %s\n", action, row, err)
+	}
+}
+
+// Stops consuming. Messages whose rows haven't finished are left unacknowledged,
+// so that the queue delivers them again.
+func (q *queueReader) Close() error {
+	return q.source.Close()
+}
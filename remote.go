@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Reports whether a -csv path is a URL to download the CSV from, rather than a
+// file.
+func isURL(path string) bool {
+	return urlScheme(path) != ""
+}
+
+// Returns the scheme of a -csv URL that we can download from, in lower case, or an
+// empty string if it isn't one.
+func urlScheme(path string) string {
+	i := strings.Index(path, "://")
+	if i < 0 {
+		return ""
+	}
+	switch scheme := strings.ToLower(path[:i]); scheme {
+	case "http", "https", "s3", "gs", "az":
+		return scheme
+	default:
+		return ""
+	}
+}
+
+// Returns the path of a URL, whose extension says how it's compressed, without
+// any query string.
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Path
+}
+
+// Starts downloading the CSV at a URL, returning the body to be read as it
+// arrives, rather than saving it anywhere first.
+func openURL(rawURL string) (io.ReadCloser, error) {
+	switch urlScheme(rawURL) {
+	case "s3":
+		return openS3(rawURL)
+	case "gs":
+		return openGCS(rawURL)
+	case "az":
+		return openAzure(rawURL)
+	}
+
+	// A gzip Content-Encoding is removed by the HTTP client.
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch '%s': %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
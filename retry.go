@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Initial delay between retries of a transient I/O error; doubled on each attempt.
+const retryBackoff = 50 * time.Millisecond
+
+// Calls `fn`, retrying up to `retries` more times with a short backoff if it fails
+// with a transient I/O error. Any other error is returned immediately, since trying
+// again won't change the outcome.
+func retryIO(retries int, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Reports whether `err` is the kind of I/O error that network and FUSE filesystems
+// return spuriously, and is worth retrying.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EBUSY) ||
+		os.IsTimeout(err)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// An image sink that fails with a transient error the first `failures` times
+// it's written to, and then writes to the sink beneath it.
+type flakySink struct {
+	sink     csvimage.ImageSink
+	failures int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (s *flakySink) Write(id, format string, r io.Reader) error {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return &os.PathError{Op: "write", Path: id, Err: syscall.EAGAIN}
+	}
+	return s.sink.Write(id, format, r)
+}
+
+func TestRetryRecoversTransientWriteError(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	sink := &flakySink{sink: opts.sink, failures: 2}
+	opts.sink = sink
+
+	stats, err := convertCSV(t, "a,"+pngData(t)+"\n", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 1 || stats.errors != 0 {
+		t.Fatalf("expected the row to be written after retrying, got %s", stats)
+	}
+	if sink.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", sink.attempts)
+	}
+	readOutput(t, opts, "a.png")
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.ioRetries = 1
+	opts.sink = &flakySink{sink: opts.sink, failures: 5}
+
+	stats, err := convertCSV(t, "a,"+pngData(t)+"\n", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.errors != 1 {
+		t.Fatalf("expected the row to fail once retries ran out, got %s", stats)
+	}
+}
+
+func TestRetryIgnoresDeterministicErrors(t *testing.T) {
+	calls := 0
+	permanent := errors.New("permission denied")
+	err := retryIO(3, func() error {
+		calls++
+		return permanent
+	})
+	if err != permanent {
+		t.Fatalf("expected the error to be returned, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+}
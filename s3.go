@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The region used for S3 when none is configured, from which the region of a
+// bucket is looked up.
+const defaultS3Region = "us-east-1"
+
+// Opens an object in S3, given as 's3://<bucket>/<key>', to be read as it
+// downloads. Credentials and the region are found as the AWS CLI finds them: from
+// the environment, the shared config and credentials files, or the instance's role.
+// The bucket needn't be in that region, as its own region is looked up first.
+func openS3(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 URL '%s': must be s3://<bucket>/<key>", rawURL)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithDefaultRegion(defaultS3Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %s", err)
+	}
+	quiet := func(o *s3.Options) {
+		// Objects uploaded without checksums are common, and fine to read.
+		o.DisableLogOutputChecksumValidationSkipped = true
+	}
+	client := s3.NewFromConfig(cfg, quiet)
+	// S3 doesn't redirect requests for a bucket to its region, but turns them
+	// away. If its region can't be found, the request is made anyway, for the
+	// error S3 gives.
+	if region, err := manager.GetBucketRegion(ctx, client, bucket); err == nil && region != cfg.Region {
+		client = s3.NewFromConfig(cfg, quiet, func(o *s3.Options) {
+			o.Region = region
+		})
+	}
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch '%s': %s", rawURL, err)
+	}
+	return out.Body, nil
+}
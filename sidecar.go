@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parses a -meta-cols value: a comma-separated list of columns, each an index or,
+// with -header, a name, or 'all'.
+func parseMetaColumns(value string, header bool) ([]string, error) {
+	if strings.TrimSpace(value) == "all" {
+		return []string{"all"}, nil
+	}
+
+	var cols []string
+	for _, part := range strings.Split(value, ",") {
+		column := strings.TrimSpace(part)
+		if index, err := strconv.Atoi(column); err == nil {
+			if index < 0 {
+				return nil, fmt.Errorf("invalid -meta-cols '%s': negative column %d", value, index)
+			}
+		} else if !header {
+			return nil, fmt.Errorf("invalid -meta-cols '%s': columns can only be chosen by name with -header", value)
+		} else if column == "" {
+			return nil, fmt.Errorf("invalid -meta-cols '%s': empty column name", value)
+		}
+		cols = append(cols, column)
+	}
+	return cols, nil
+}
+
+// Writes a row's metadata to './output/<filename>.json'.
+func writeSidecar(filename string, meta map[string]string, opts *options) (output string) {
+	path := outputPath(opts.sink, filename, "json")
+
+	encoded, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("Failed to encode metadata for '%s': %s\n", filename, err)
+	}
+
+	err = retryIO(opts.ioRetries, func() error {
+		return opts.sink.Write(filename, "json", bytes.NewReader(append(encoded, '\n')))
+	})
+	if err != nil {
+		return fmt.Sprintf("Failed to write metadata file '%s': %s\n", path, err)
+	}
+	return fmt.Sprintf("Wrote metadata to '%s'\n\n", path)
+}
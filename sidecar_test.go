@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSidecar(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   bool
+		metaCols []string
+		csv      string
+		expected map[string]string
+	}{
+		{"by index", false, []string{"2", "3"}, "a,%s,sunset,2019\n", map[string]string{"2": "sunset", "3": "2019"}},
+		{"by name", true, []string{"caption"}, "id,data,caption,year\na,%s,sunset,2019\n", map[string]string{"caption": "sunset"}},
+		{"all", true, []string{"all"}, "id,data,caption,year\na,%s,sunset,2019\n", map[string]string{"caption": "sunset", "year": "2019"}},
+	}
+
+	for _, test := range tests {
+		opts := testOptions(t.TempDir())
+		opts.header = test.header
+		opts.metaCols = test.metaCols
+
+		if _, err := convertCSV(t, fmt.Sprintf(test.csv, pngData(t)), opts); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var meta map[string]string
+		if err := json.Unmarshal(readOutput(t, opts, "a.json"), &meta); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !reflect.DeepEqual(meta, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, meta)
+		}
+	}
+}
+
+func TestSidecarSkippedForFailedRows(t *testing.T) {
+	for _, always := range []bool{false, true} {
+		opts := testOptions(t.TempDir())
+		opts.metaCols = []string{"2"}
+		opts.metaAlways = always
+
+		if _, err := convertCSV(t, "a,bm90IGFuIGltYWdl,sunset\n", opts); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ioutil.ReadFile(filepath.Join(opts.outputDir, "a.json"))
+		if written := err == nil; written != always {
+			t.Errorf("-meta-always=%t: expected the sidecar to be written: %t, got %t", always, always, written)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A field longer than -max-field-bytes. The start of it is kept in its row, and
+// the rest is spooled to a temporary file, so that the whole of it needn't be held
+// in memory.
+type spooledField struct {
+	file *os.File
+	size int64
+	// What follows the start of the field in its row, to identify it.
+	marker string
+	// Which field of its row it is, once it's been taken from the row.
+	index int
+}
+
+// Returns a reader of the whole field, given its start.
+func (f *spooledField) reader(start string) io.Reader {
+	return io.MultiReader(strings.NewReader(start), f.rest())
+}
+
+// Returns a reader of the rest of the field, after its start. Each reads it from
+// the beginning.
+func (f *spooledField) rest() io.Reader {
+	return io.NewSectionReader(f.file, 0, f.size)
+}
+
+// Returns a copy of `record`, the row the field was taken from, with the whole of
+// the field in place of its start. This reads the field into memory, so it's only
+// for rows that need writing out as they were, like those for -dead-letter.
+func (f *spooledField) restore(record []string) []string {
+	restored := append([]string(nil), record...)
+	if rest, err := ioutil.ReadAll(f.rest()); err == nil {
+		restored[f.index] += string(rest)
+	}
+	return restored
+}
+
+// Removes the file the field was spooled to. Closing a nil field does nothing.
+func (f *spooledField) Close() error {
+	if f == nil {
+		return nil
+	}
+	err := f.file.Close()
+	if removeErr := os.Remove(f.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Keeps track of the fields of a CSV that a fieldLimiter has spooled to temporary
+// files, until they're taken from their rows. Each is cut short in its row, and
+// followed by a marker, two NUL bytes around a number, which the delimiter can't
+// be part of.
+type spooler struct {
+	mu     sync.Mutex
+	dir    string
+	fields map[string]*spooledField
+	count  int
+}
+
+func newSpooler() *spooler {
+	return &spooler{fields: map[string]*spooledField{}}
+}
+
+// Creates the file for a field to be spooled to, in a temporary directory that's
+// created the first time.
+func (s *spooler) create() (*spooledField, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		dir, err := ioutil.TempDir("", "csv-image-spool-")
+		if err != nil {
+			return nil, err
+		}
+		s.dir = dir
+	}
+
+	s.count++
+	f, err := os.Create(filepath.Join(s.dir, strconv.Itoa(s.count)))
+	if err != nil {
+		return nil, err
+	}
+	return &spooledField{file: f, marker: "\x00" + strconv.Itoa(s.count) + "\x00"}, nil
+}
+
+// Adds a field that's been spooled, so that it can be taken from its row.
+func (s *spooler) add(field *spooledField) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fields[field.marker] = field
+}
+
+// Takes the spooled field from a row, if it has one, cutting its marker from the
+// row. Only the field at index `dataCol` may have been spooled: if any other was,
+// the row can't be converted, and `tooLarge` is true. Closing the field once the
+// row has been converted is up to the caller.
+func (s *spooler) take(record []string, dataCol int) (field *spooledField, tooLarge bool) {
+	for i, value := range record {
+		f := s.remove(value)
+		if f == nil {
+			continue
+		}
+		if i != dataCol {
+			f.Close()
+			tooLarge = true
+			continue
+		}
+		record[i] = value[:len(value)-len(f.marker)]
+		f.index = i
+		field = f
+	}
+	if tooLarge {
+		field.Close()
+		return nil, true
+	}
+	return field, false
+}
+
+// Removes the field a value ends with the marker of, and returns it, or nil if
+// it doesn't end with one.
+func (s *spooler) remove(value string) *spooledField {
+	if len(value) < 3 || value[len(value)-1] != 0 {
+		return nil
+	}
+	start := strings.LastIndexByte(value[:len(value)-1], 0)
+	if start < 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	marker := value[start:]
+	field := s.fields[marker]
+	delete(s.fields, marker)
+	return field
+}
+
+// Removes every field that hasn't been taken, such as those of rows that were
+// skipped, along with the temporary directory.
+func (s *spooler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for marker, field := range s.fields {
+		field.Close()
+		delete(s.fields, marker)
+	}
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
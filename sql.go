@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// The database types of columns holding bytes rather than text, in upper case.
+var binaryColumnTypes = map[string]bool{
+	"BLOB":       true,
+	"TINYBLOB":   true,
+	"MEDIUMBLOB": true,
+	"LONGBLOB":   true,
+	"BINARY":     true,
+	"VARBINARY":  true,
+	"BYTEA":      true,
+}
+
+// Reads the rows returned by a query, like csv.Reader. The first row is a header
+// of the names of its columns.
+//
+// Values are read as text, so that they can be written to metadata files and
+// -dead-letter CSVs like any other field: NULL is empty, and times are in RFC
+// 3339 format. Binary values, like blobs, are encoded according to -encoding, so
+// that images stored as bytes are converted as they are, and with -encoding raw,
+// aren't encoded at all. The database must be closed once the reader is no longer
+// needed.
+type sqlReader struct {
+	db       *sql.DB
+	rows     *sql.Rows
+	encoding string
+	// Cancels the query, so that closing the reader early doesn't wait for the
+	// rest of its rows.
+	cancel context.CancelFunc
+
+	header []string
+	binary []bool
+	values []interface{}
+	// Whether the header's been returned.
+	started bool
+}
+
+// Opens the SQLite database at `path`, read-only, and runs `query` on it.
+func querySQLite(path, query, encoding string) (*sqlReader, error) {
+	// SQLite would otherwise create a database that doesn't exist.
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: path}).String()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	return newSQLReader(db, query, encoding)
+}
+
+// Connects to the database at `dsn`, as given to -db-dsn, and runs `query` on it.
+func queryDatabase(dsn, query, encoding string) (*sqlReader, error) {
+	db, err := openDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLReader(db, query, encoding)
+}
+
+// Returns a handle to the database at `dsn`, a postgres:// or mysql:// URL, without
+// connecting to it yet.
+func openDatabase(dsn string) (*sql.DB, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// The error would repeat the URL, password and all.
+		return nil, fmt.Errorf("invalid -db-dsn: must be a postgres:// or mysql:// URL")
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return sql.Open("pgx", dsn)
+	case "mysql":
+		// The driver takes DSNs of its own form, like 'user:password@tcp(host)/db'.
+		cfg, err := mysql.ParseDSN(fmt.Sprintf("tcp(%s)%s?%s", u.Host, u.EscapedPath(), u.RawQuery))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -db-dsn: %s", err)
+		}
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+	default:
+		return nil, fmt.Errorf("invalid -db-dsn: must be a postgres:// or mysql:// URL")
+	}
+}
+
+// Returns `dsn` with any password replaced, to show in messages and checkpoints.
+func dsnName(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "database"
+	}
+	return u.Redacted()
+}
+
+// Runs `query` on `db`, to read the rows it returns. The database is closed if
+// the query fails.
+func newSQLReader(db *sql.DB, query, encoding string) (*sqlReader, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		cancel()
+		db.Close()
+		return nil, fmt.Errorf("query failed: %s", err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		cancel()
+		rows.Close()
+		db.Close()
+		return nil, err
+	}
+
+	s := &sqlReader{db: db, rows: rows, encoding: encoding, cancel: cancel}
+	for _, t := range types {
+		s.header = append(s.header, t.Name())
+		s.binary = append(s.binary, binaryColumnTypes[strings.ToUpper(t.DatabaseTypeName())] || t.DatabaseTypeName() == "")
+		s.values = append(s.values, new(interface{}))
+	}
+	return s, nil
+}
+
+func (s *sqlReader) Read() ([]string, error) {
+	if !s.started {
+		s.started = true
+		return s.header, nil
+	}
+
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if err := s.rows.Scan(s.values...); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(s.values))
+	for i, value := range s.values {
+		record[i] = s.field(*value.(*interface{}), s.binary[i])
+	}
+	return record, nil
+}
+
+// Returns a value as text. Bytes are only binary if their column is; drivers
+// return text as bytes too.
+func (s *sqlReader) field(value interface{}, binary bool) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		if binary {
+			return csvimage.EncodeData(v, s.encoding)
+		}
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// There's no text of the rows to point to, so there's none to record for them
+// either.
+func (s *sqlReader) InputOffset() int64 {
+	return 0
+}
+
+func (s *sqlReader) Close() error {
+	s.cancel()
+	s.rows.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Creates a SQLite database of photos, with an image stored as a blob, and
+// returns its path.
+func photoDatabase(t testing.TB, image []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photos.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range []string{
+		"CREATE TABLE photos (id TEXT, image BLOB, width INTEGER, caption TEXT)",
+		"INSERT INTO photos VALUES ('a', ?, 4, NULL)",
+	} {
+		if _, err := db.Exec(statement, image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestQuerySQLite(t *testing.T) {
+	path := photoDatabase(t, []byte{0, 255})
+	r, err := querySQLite(path, "SELECT id, image, width, caption FROM photos", "base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, want := range [][]string{{"id", "image", "width", "caption"}, {"a", "AP8=", "4", ""}} {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(record, want) {
+			t.Errorf("expected %q, got %q", want, record)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected the end of the rows, got %v", err)
+	}
+}
+
+func TestQuerySQLiteIsReadOnly(t *testing.T) {
+	if _, err := querySQLite(filepath.Join(t.TempDir(), "missing.db"), "SELECT 1", "base64"); err == nil {
+		t.Error("expected a database that doesn't exist not to be created")
+	}
+	path := photoDatabase(t, nil)
+	r, err := querySQLite(path, "DELETE FROM photos", "base64")
+	if err == nil {
+		r.Close()
+		t.Error("expected the database to be opened read-only")
+	}
+}
+
+func TestConvertSQLite(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.inputFormat = "sqlite"
+	opts.query = "SELECT id, image FROM photos"
+	opts.header = true
+	original := pngBytes(t, testImage(4, 3))
+
+	stats := newSummary()
+	if err := convertFile(context.Background(), photoDatabase(t, original), opts, stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 1 {
+		t.Fatalf("expected the image to be written, got %s", stats)
+	}
+	if !bytes.Equal(readOutput(t, opts, "a.png"), original) {
+		t.Error("the image written isn't the original")
+	}
+}
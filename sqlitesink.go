@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// The most writes committed in a single transaction by a sqliteSink.
+const sqliteBatch = 100
+
+// Writes images to a table of blobs in a SQLite database, for '-sink sqlite:path',
+// rather than to files. Each is keyed by its identifier and format, so that an
+// image and its metadata, say, are kept apart as their files would be, and
+// writing one again replaces it.
+//
+// SQLite allows only one writer at a time, so rather than having workers take
+// turns at the database, every write is handed to a single goroutine that makes
+// them. It commits whatever writes are waiting in one transaction, and only then
+// returns from each of them, so a write that's returned is never lost, however
+// the process ends. The sink must be closed once nothing more is written to it.
+type sqliteSink struct {
+	path   string
+	db     *sql.DB
+	writes chan sqliteWrite
+	done   chan struct{}
+}
+
+// A write waiting for the writer goroutine, which sends its outcome to `result`.
+type sqliteWrite struct {
+	id, format string
+	data       []byte
+	result     chan error
+}
+
+// Opens or creates the SQLite database at `path`, along with its table of images,
+// and starts the goroutine that writes to it.
+func openSQLiteSink(path string) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: path}).String()+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// Reads, for -skip-existing, wait for the writer instead of failing while it
+	// holds the lock.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS images (
+		id TEXT NOT NULL,
+		format TEXT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (id, format)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the table of images in '%s': %s", path, err)
+	}
+
+	s := &sqliteSink{path: path, db: db, writes: make(chan sqliteWrite, sqliteBatch), done: make(chan struct{})}
+	go s.run()
+	return s, nil
+}
+
+// Parses a -sink value, returning the path of the SQLite database it names.
+func parseSink(value string) (string, error) {
+	path := strings.TrimPrefix(value, "sqlite:")
+	if path == value || path == "" {
+		return "", fmt.Errorf("invalid -sink '%s': expected sqlite:<path>, like sqlite:images.db", value)
+	}
+	return path, nil
+}
+
+func (s *sqliteSink) Write(id, format string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	s.writes <- sqliteWrite{id: id, format: format, data: data, result: result}
+	return <-result
+}
+
+// Reports whether the database already holds an image.
+func (s *sqliteSink) Exists(id, format string) bool {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM images WHERE id = ? AND format = ?)`, id, format).Scan(&exists)
+	return err == nil && exists
+}
+
+// Makes the writes handed to the sink, a transaction at a time, until it's closed.
+func (s *sqliteSink) run() {
+	defer close(s.done)
+	for w := range s.writes {
+		batch := []sqliteWrite{w}
+	gather:
+		for len(batch) < sqliteBatch {
+			select {
+			case w, ok := <-s.writes:
+				if !ok {
+					break gather
+				}
+				batch = append(batch, w)
+			default:
+				break gather
+			}
+		}
+
+		err := s.commit(batch)
+		for _, w := range batch {
+			w.result <- err
+		}
+	}
+}
+
+// Writes a batch of images in a single transaction.
+func (s *sqliteSink) commit(batch []sqliteWrite) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, w := range batch {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO images (id, format, data) VALUES (?, ?, ?)`, w.id, w.format, w.data)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Waits for the writes in progress, then closes the database.
+func (s *sqliteSink) Close() error {
+	close(s.writes)
+	<-s.done
+	return s.db.Close()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteSink(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.workers = 4
+	path := filepath.Join(t.TempDir(), "images.db")
+	sink, err := openSQLiteSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.sink = sink
+	stats, err := convertCSV(t, numberedCSV(t, 20), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 20 {
+		t.Fatalf("expected 20 images written, got %d", stats.success)
+	}
+	if images := outputImages(t, opts); len(images) != 0 {
+		t.Errorf("expected no image files, got %v", images)
+	}
+
+	// Images already in the database are skipped.
+	opts.skipExisting = true
+	if stats, err = convertCSV(t, numberedCSV(t, 21), opts); err != nil {
+		t.Fatal(err)
+	}
+	if stats.success != 1 || stats.skipped != 20 {
+		t.Errorf("expected 1 image written and 20 skipped, got %d and %d", stats.success, stats.skipped)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT id, format, data FROM images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		var id, format string
+		var data []byte
+		if err := rows.Scan(&id, &format, &data); err != nil {
+			t.Fatal(err)
+		}
+		img, decoded, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %s", id, err)
+		}
+		if format != "png" || decoded != "png" || img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+			t.Errorf("%s: expected a 4x3 png, got a %dx%d %s stored as %s", id, img.Bounds().Dx(), img.Bounds().Dy(), decoded, format)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 21 {
+		t.Errorf("expected 21 images in the database, got %d", count)
+	}
+}
+
+func TestParseSink(t *testing.T) {
+	if path, err := parseSink("sqlite:out/images.db"); err != nil || path != "out/images.db" {
+		t.Errorf("expected out/images.db, got '%s' (%v)", path, err)
+	}
+	for _, value := range []string{"images.db", "sqlite:", "postgres://host/db"} {
+		if _, err := parseSink(value); err == nil {
+			t.Errorf("expected '%s' to be invalid", value)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The outcome of processing a single row.
+type result int
+
+const (
+	// The image was decoded and written to the output directory.
+	written result = iota
+	// The data couldn't be decoded as an image, and was dumped to a '.txt' file.
+	dumped
+	// The image couldn't be written.
+	failed
+	// The encoded image was larger than -max-output-bytes, so it wasn't written.
+	tooLarge
+	// The data wasn't a recognizable image, so its decoded bytes were written as-is.
+	raw
+)
+
+// Returns the name of a result, as used in JSON output.
+func (r result) String() string {
+	switch r {
+	case written:
+		return "written"
+	case dumped:
+		return "dumped"
+	case tooLarge:
+		return "too_large"
+	case raw:
+		return "raw"
+	default:
+		return "failed"
+	}
+}
+
+// Tallies the outcome of every row in a run. Safe for concurrent use.
+type summary struct {
+	mu       sync.Mutex
+	start    time.Time
+	total    int
+	success  int
+	dumped   int
+	errors   int
+	skipped  int
+	tooLarge int
+	raw      int
+	formats  map[string]int
+	// With -sample, the rows it chose to process, and those it left out, which
+	// aren't counted as skipped.
+	sampled   int
+	unsampled int
+}
+
+func newSummary() *summary {
+	return &summary{start: time.Now(), formats: map[string]int{}}
+}
+
+// Records the outcome of a row, along with the format it was written as.
+func (s *summary) record(res result, format string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total++
+	switch res {
+	case written:
+		s.success++
+		s.formats[format]++
+	case dumped:
+		s.dumped++
+	case failed:
+		s.errors++
+	case tooLarge:
+		s.tooLarge++
+	case raw:
+		s.raw++
+	}
+}
+
+// Records a row that was read but deliberately not processed.
+func (s *summary) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped++
+}
+
+// Records whether -sample chose a row to process or left it out.
+func (s *summary) sample(chosen bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chosen {
+		s.sampled++
+	} else {
+		s.unsampled++
+	}
+}
+
+// Returns the number of rows that couldn't be converted, because they were dumped
+// or failed outright, and the number of rows processed.
+func (s *summary) failures() (failures, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dumped + s.errors, s.total
+}
+
+// Returns a one-line, human-readable description of the run.
+func (s *summary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sampled string
+	if s.sampled > 0 || s.unsampled > 0 {
+		sampled = fmt.Sprintf(" %d of %d rows read were sampled, and the other %d left out.", s.sampled, s.sampled+s.unsampled, s.unsampled)
+	}
+	return fmt.Sprintf(
+		"Processed %d rows in %s: %d written, %d raw, %d dumped, %d too large, %d errors, %d skipped.%s",
+		s.total, time.Since(s.start).Round(time.Millisecond), s.success, s.raw, s.dumped, s.tooLarge, s.errors, s.skipped, sampled,
+	)
+}
+
+// Returns the summary as a JSON object, for consumption by other tools. Rows that
+// couldn't be converted are counted by reason: dumped, error, or too_large. With
+// -sample, sampled and unsampled count the rows it chose and left out.
+func (s *summary) JSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.start).Seconds()
+
+	return json.Marshal(struct {
+		Total          int            `json:"total"`
+		Success        int            `json:"success"`
+		Dumped         int            `json:"dumped"`
+		Error          int            `json:"error"`
+		Skipped        int            `json:"skipped"`
+		TooLarge       int            `json:"too_large"`
+		Raw            int            `json:"raw"`
+		Sampled        int            `json:"sampled"`
+		Unsampled      int            `json:"unsampled"`
+		Formats        map[string]int `json:"formats"`
+		ElapsedSeconds float64        `json:"elapsed_seconds"`
+		RowsPerSecond  float64        `json:"rows_per_second"`
+	}{
+		Total:          s.total,
+		Success:        s.success,
+		Dumped:         s.dumped,
+		Error:          s.errors,
+		Skipped:        s.skipped,
+		TooLarge:       s.tooLarge,
+		Raw:            s.raw,
+		Sampled:        s.sampled,
+		Unsampled:      s.unsampled,
+		Formats:        s.formats,
+		ElapsedSeconds: elapsed,
+		RowsPerSecond:  float64(s.total) / elapsed,
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestSummaryJSON(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	jpegData := base64.StdEncoding.EncodeToString(jpegBytes(t, testImage(8, 8)))
+	contents := "a," + pngData(t) + "\nb," + jpegData + "\nc,bm90IGFuIGltYWdl\n"
+	stats, err := convertCSV(t, contents, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := stats.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Total          int            `json:"total"`
+		Success        int            `json:"success"`
+		Dumped         int            `json:"dumped"`
+		Error          int            `json:"error"`
+		Formats        map[string]int `json:"formats"`
+		ElapsedSeconds *float64       `json:"elapsed_seconds"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("invalid JSON %s: %s", out, err)
+	}
+
+	if got.Total != 3 || got.Success != 2 || got.Dumped != 1 || got.Error != 0 {
+		t.Errorf("unexpected counts in %s", out)
+	}
+	if got.Formats["png"] != 1 || got.Formats["jpeg"] != 1 {
+		t.Errorf("unexpected formats in %s", out)
+	}
+	if got.ElapsedSeconds == nil || *got.ElapsedSeconds < 0 {
+		t.Errorf("missing elapsed time in %s", out)
+	}
+}
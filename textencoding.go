@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Returns a reader of the text from `r` as UTF-8, without any byte order mark, as
+// CSVs exported by Windows tools often start with. UTF-16 text is recognized by its
+// byte order mark, or failing that by the zero bytes alternating with the ASCII
+// characters it starts with, and transcoded. Anything else is assumed to be UTF-8
+// already.
+func utf8Reader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(start, []byte{0xef, 0xbb, 0xbf}):
+		br.Discard(3)
+		return br
+	case bytes.HasPrefix(start, []byte{0xff, 0xfe}):
+		br.Discard(2)
+		return newUTF16Reader(br, binary.LittleEndian)
+	case bytes.HasPrefix(start, []byte{0xfe, 0xff}):
+		br.Discard(2)
+		return newUTF16Reader(br, binary.BigEndian)
+	case len(start) == 4 && start[0] != 0 && start[1] == 0 && start[2] != 0 && start[3] == 0:
+		return newUTF16Reader(br, binary.LittleEndian)
+	case len(start) == 4 && start[0] == 0 && start[1] != 0 && start[2] == 0 && start[3] != 0:
+		return newUTF16Reader(br, binary.BigEndian)
+	default:
+		return br
+	}
+}
+
+// Transcodes UTF-16 to UTF-8. Unpaired surrogates and a trailing odd byte become
+// the Unicode replacement character.
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	// A code unit read while looking for the second half of a surrogate pair that
+	// turned out not to be one, or -1.
+	unread int
+	// The encoding of a rune that didn't fit in the last buffer read into.
+	pending []byte
+}
+
+func newUTF16Reader(r *bufio.Reader, order binary.ByteOrder) *utf16Reader {
+	return &utf16Reader{r: r, order: order, unread: -1}
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	if len(u.pending) > 0 {
+		n := copy(p, u.pending)
+		u.pending = u.pending[n:]
+		return n, nil
+	}
+
+	// Transcode whatever's buffered in one go, as image data can be tens of
+	// megabytes, leaving anything unusual for readRune.
+	n := 0
+	if u.unread < 0 {
+		if _, err := u.r.Peek(2); err == nil {
+			buf, _ := u.r.Peek(u.r.Buffered())
+			i := 0
+			for ; i+1 < len(buf) && n+utf8.UTFMax <= len(p); i += 2 {
+				unit := u.order.Uint16(buf[i:])
+				if unit < utf8.RuneSelf {
+					p[n] = byte(unit)
+					n++
+					continue
+				}
+				if utf16.IsSurrogate(rune(unit)) {
+					break
+				}
+				n += utf8.EncodeRune(p[n:], rune(unit))
+			}
+			u.r.Discard(i)
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+
+	r, err := u.readRune()
+	if err != nil {
+		return 0, err
+	}
+	var encoded [utf8.UTFMax]byte
+	size := utf8.EncodeRune(encoded[:], r)
+	n = copy(p, encoded[:size])
+	u.pending = append(u.pending[:0], encoded[n:size]...)
+	return n, nil
+}
+
+func (u *utf16Reader) readRune() (rune, error) {
+	first, err := u.readUnit()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(rune(first)) {
+		return rune(first), nil
+	}
+
+	second, err := u.readUnit()
+	if err == io.EOF {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if r := utf16.DecodeRune(rune(first), rune(second)); r != utf8.RuneError {
+		return r, nil
+	}
+	// Not a pair after all, so the second unit starts the next rune.
+	u.unread = second
+	return utf8.RuneError, nil
+}
+
+func (u *utf16Reader) readUnit() (int, error) {
+	if u.unread >= 0 {
+		unit := u.unread
+		u.unread = -1
+		return unit, nil
+	}
+
+	var b [2]byte
+	_, err := io.ReadFull(u.r, b[:])
+	if err == io.ErrUnexpectedEOF {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(u.order.Uint16(b[:])), nil
+}
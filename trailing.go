@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// Drops empty fields from the end of each row of a CSV without a header, as left
+// by exports that append trailing commas to every row, before its columns are
+// chosen. At least `keep` fields are kept, so that an empty data column is still
+// treated as data.
+//
+// csv.Reader expects every row to have as many fields as the first, so a row with
+// more or fewer trailing commas than that would be taken for a malformed one.
+// Instead, unless -lenient allows any number, a row only has too many fields if
+// it has more than the first once its empty ones are dropped.
+type trailingTrimmer struct {
+	r      recordReader
+	strict *csv.Reader
+	keep   int
+	// The number of fields in the first row, and how many rows have been read.
+	fields, rows int
+	// How many rows had fields dropped, and the first of them.
+	trimmed, first int
+}
+
+func newTrailingTrimmer(r recordReader, lenient bool) *trailingTrimmer {
+	t := &trailingTrimmer{r: r, fields: -1}
+	if reader, ok := r.(*csv.Reader); ok {
+		// The number of fields is checked here instead.
+		reader.FieldsPerRecord = -1
+		if !lenient {
+			t.strict = reader
+		}
+	}
+	return t
+}
+
+func (t *trailingTrimmer) Read() ([]string, error) {
+	record, err := t.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	t.rows++
+	if err != nil {
+		return record, err
+	}
+	if t.fields < 0 {
+		t.fields = len(record)
+	}
+
+	if trimmed := trimTrailingEmpty(record, t.keep); len(trimmed) < len(record) {
+		if t.trimmed == 0 {
+			t.first = t.rows
+		}
+		t.trimmed++
+		record = trimmed
+	}
+	if t.strict != nil && len(record) > t.fields {
+		line, _ := t.strict.FieldPos(0)
+		return record, &csv.ParseError{StartLine: line, Line: line, Column: 1, Err: csv.ErrFieldCount}
+	}
+	return record, nil
+}
+
+func (t *trailingTrimmer) InputOffset() int64 {
+	return t.r.InputOffset()
+}
+
+// Drops empty fields from the end of a record, but always keeps at least `keep`
+// fields.
+func trimTrailingEmpty(record []string, keep int) []string {
+	end := len(record)
+	for end > keep && record[end-1] == "" {
+		end--
+	}
+	return record[:end]
+}
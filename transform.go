@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+// Parses a -fit value of the form 'WxH' or 'WxH,pad=<color>', where the color is
+// either a name (black, white, transparent) or hex ('#rrggbb' or '#rrggbbaa').
+// Padding defaults to black.
+func parseFit(value string) (*csvimage.Fit, error) {
+	parts := strings.Split(value, ",")
+
+	dims := strings.SplitN(parts[0], "x", 2)
+	if len(dims) != 2 {
+		return nil, fmt.Errorf("invalid -fit '%s': expected WxH", value)
+	}
+	width, err := strconv.Atoi(dims[0])
+	if err != nil || width <= 0 {
+		return nil, fmt.Errorf("invalid -fit width '%s'", dims[0])
+	}
+	height, err := strconv.Atoi(dims[1])
+	if err != nil || height <= 0 {
+		return nil, fmt.Errorf("invalid -fit height '%s'", dims[1])
+	}
+
+	spec := &csvimage.Fit{Width: width, Height: height, Pad: color.Black}
+	for _, option := range parts[1:] {
+		if !strings.HasPrefix(option, "pad=") {
+			return nil, fmt.Errorf("invalid -fit option '%s'", option)
+		}
+		spec.Pad, err = parseColor(strings.TrimPrefix(option, "pad="))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spec, nil
+}
+
+// Parses a color name or a hex color of the form '#rrggbb' or '#rrggbbaa'.
+func parseColor(value string) (color.Color, error) {
+	switch strings.ToLower(value) {
+	case "black":
+		return color.Black, nil
+	case "white":
+		return color.White, nil
+	case "transparent":
+		return color.Transparent, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color '%s'", value)
+	}
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color '%s'", value)
+	}
+
+	return color.NRGBA{
+		R: uint8(rgba >> 24),
+		G: uint8(rgba >> 16),
+		B: uint8(rgba >> 8),
+		A: uint8(rgba),
+	}, nil
+}
+
+// Parses a -crop value of the form 'x,y,w,h' into the rectangle it describes.
+func parseCrop(value string) (image.Rectangle, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid -crop '%s': expected x,y,w,h", value)
+	}
+
+	var n [4]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 0 {
+			return image.Rectangle{}, fmt.Errorf("invalid -crop '%s': expected non-negative integers", value)
+		}
+		n[i] = v
+	}
+	if n[2] == 0 || n[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid -crop '%s': width and height must be positive", value)
+	}
+
+	return image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3]), nil
+}
+
+// Checks the options for transform settings that contradict each other or won't
+// have any effect, returning an error for those that can't be honored and a
+// warning for those that will be ignored. `set` holds the names of the flags given
+// on the command line.
+func checkTransforms(opts *options, set map[string]bool, detect bool) (warnings []string, err error) {
+	if opts.conv.Trim != nil && (opts.conv.Trim.Tolerance < 0 || opts.conv.Trim.Tolerance > 255) {
+		return nil, fmt.Errorf("-trim-tolerance must be between 0 and 255, got %d", opts.conv.Trim.Tolerance)
+	}
+	// Both give the size of the output, and only one of them can have its way.
+	if opts.conv.Crop != nil && opts.conv.Fit != nil {
+		return nil, fmt.Errorf("-crop and -fit can't be combined, since each sets the size of the images written")
+	}
+
+	if opts.conv.Trim == nil {
+		for _, name := range []string{"trim-color", "trim-tolerance"} {
+			if set[name] {
+				warnings = append(warnings, fmt.Sprintf("-%s has no effect without -trim-border", name))
+			}
+		}
+	}
+
+	if opts.conv.Fit != nil && opts.conv.Format == "jpeg" {
+		if _, _, _, a := opts.conv.Fit.Pad.RGBA(); a < 0xffff {
+			warnings = append(warnings, "-fit padding will be opaque, since JPEGs don't support transparency")
+		}
+	}
+
+	if detect && opts.conv.HasTransforms() {
+		warnings = append(warnings, "transforms have no effect with -detect, which reports images as they're stored")
+	}
+
+	return warnings, nil
+}
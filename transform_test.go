@@ -0,0 +1,121 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/qsymmachus/csv-image/csvimage"
+)
+
+func TestCheckTransforms(t *testing.T) {
+	crop := image.Rect(0, 0, 10, 10)
+	tests := []struct {
+		name    string
+		conv    csvimage.Converter
+		set     []string
+		detect  bool
+		err     string
+		warning string
+	}{
+		{name: "no transforms"},
+		{
+			name: "tolerance out of range",
+			conv: csvimage.Converter{Trim: &csvimage.Trim{Tolerance: 300}},
+			err:  "-trim-tolerance must be between 0 and 255",
+		},
+		{
+			name: "crop and fit",
+			conv: csvimage.Converter{Crop: &crop, Fit: &csvimage.Fit{Width: 10, Height: 10}},
+			err:  "-crop and -fit can't be combined",
+		},
+		{
+			name: "crop, trim and fit",
+			conv: csvimage.Converter{Crop: &crop, Trim: &csvimage.Trim{}, Fit: &csvimage.Fit{Width: 10, Height: 10}},
+			err:  "-crop and -fit can't be combined",
+		},
+		{
+			name: "crop and trim",
+			conv: csvimage.Converter{Crop: &crop, Trim: &csvimage.Trim{}},
+		},
+		{
+			name: "trim and fit",
+			conv: csvimage.Converter{Trim: &csvimage.Trim{}, Fit: &csvimage.Fit{Width: 10, Height: 10, Pad: color.Black}},
+		},
+		{
+			name:    "trim settings without -trim-border",
+			set:     []string{"trim-color"},
+			warning: "-trim-color has no effect without -trim-border",
+		},
+		{
+			name:    "transparent padding for JPEGs",
+			conv:    csvimage.Converter{Format: "jpeg", Fit: &csvimage.Fit{Width: 1, Height: 1, Pad: color.Transparent}},
+			warning: "-fit padding will be opaque",
+		},
+		{
+			name:    "transforms with -detect",
+			conv:    csvimage.Converter{Crop: &crop},
+			detect:  true,
+			warning: "transforms have no effect with -detect",
+		},
+	}
+
+	for _, test := range tests {
+		opts := testOptions(t.TempDir())
+		opts.conv = &test.conv
+		set := map[string]bool{}
+		for _, name := range test.set {
+			set[name] = true
+		}
+
+		warnings, err := checkTransforms(opts, set, test.detect)
+		switch {
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.err, err)
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+		if got := strings.Join(warnings, "\n"); test.warning == "" && got != "" || !strings.Contains(got, test.warning) {
+			t.Errorf("%s: expected a warning containing %q, got %q", test.name, test.warning, got)
+		}
+	}
+}
+
+// Transforms are always applied in the same order, crop, then trim, then fit,
+// whatever order they're given in.
+func TestTransformOrder(t *testing.T) {
+	// A white 20x10 image with a black 10x10 square on the left, framed by a
+	// 2-pixel red border.
+	img := image.NewNRGBA(image.Rect(0, 0, 24, 14))
+	for y := 0; y < 14; y++ {
+		for x := 0; x < 24; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 2 && x < 22 && y >= 2 && y < 12 {
+				c = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+				if x < 12 {
+					c = color.NRGBA{A: 255}
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	// Cropping to the left half keeps the border on three sides, trimming it
+	// leaves the black square, and fitting scales that up.
+	crop := image.Rect(0, 0, 12, 14)
+	conv := &csvimage.Converter{
+		Crop: &crop,
+		Trim: &csvimage.Trim{Color: color.NRGBA{R: 255, A: 255}},
+		Fit:  &csvimage.Fit{Width: 30, Height: 30, Pad: color.White},
+	}
+	out := conv.Transform(img)
+	if b := out.Bounds(); b.Dx() != 30 || b.Dy() != 30 {
+		t.Fatalf("expected a 30x30 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	for _, p := range []image.Point{{0, 0}, {15, 15}, {29, 29}} {
+		if r, g, b, _ := out.At(p.X, p.Y).RGBA(); r > 0x1000 || g > 0x1000 || b > 0x1000 {
+			t.Errorf("expected black at %v, as only the square is left to fit, got %v", p, out.At(p.X, p.Y))
+		}
+	}
+}
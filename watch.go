@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How often a watched file is checked for new data once we've read to its end.
+const watchInterval = 500 * time.Millisecond
+
+// Returned by a tailReader once its context is cancelled.
+var errWatchStopped = errors.New("stopped watching")
+
+// Reads a file that's still being appended to, like `tail -f`. Instead of returning
+// io.EOF at the end of the file, it waits for more data to be written, until its
+// context is cancelled.
+type tailReader struct {
+	ctx    context.Context
+	file   *os.File
+	offset int64
+}
+
+// Opens the file at `path` for tailing from its beginning.
+func newTailReader(ctx context.Context, path string) (*tailReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tailReader{ctx: ctx, file: file}, nil
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.file.Read(p)
+		t.offset += int64(n)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return 0, errWatchStopped
+		case <-time.After(watchInterval):
+		}
+
+		// If the file was truncated or replaced with something shorter, there's no
+		// telling which rows are new.
+		info, err := t.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() < t.offset {
+			return 0, fmt.Errorf("'%s' shrank from %d to %d bytes while being watched", t.file.Name(), t.offset, info.Size())
+		}
+	}
+}
+
+func (t *tailReader) Close() error {
+	return t.file.Close()
+}
+
+// How often a watched directory is checked for new CSVs.
+const dirWatchInterval = 2 * time.Second
+
+// The name of the file in the output directory that lists the CSVs a watched
+// directory has had converted, so that they aren't converted again after a restart.
+const watchedName = ".csv-image-watched"
+
+// Converts the CSVs in `dir`, and with `recursive` its subdirectories, as
+// convertFiles does, and then each new one that appears there, until the context is
+// cancelled. So that files still being uploaded aren't converted half finished, a
+// CSV is only converted once a file named after it with `doneSuffix` appears next
+// to it, like 'batch.csv.done', or without a suffix, once its size has stopped
+// changing between checks.
+func watchDir(ctx context.Context, dir string, recursive bool, doneSuffix string, opts *options, stats *summary, workers int) error {
+	converted, err := readWatched(opts.outputDir)
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	// The CSVs that failed to convert, and when each was last modified, so that
+	// one is tried again once it's been replaced, rather than every time the
+	// directory is checked. They aren't listed in the watched file, so they're
+	// tried again after a restart too.
+	failed := map[string]time.Time{}
+	record := func(file string, err error) {
+		if err != nil {
+			if info, statErr := os.Stat(file); statErr == nil {
+				failed[file] = info.ModTime()
+			}
+			return
+		}
+		delete(failed, file)
+		rel := watchedKey(dir, file)
+		converted[rel] = true
+		if !opts.dryRun {
+			if err := appendWatched(opts.outputDir, rel); err != nil {
+				fmt.Fprintf(opts.messages, "Warning: failed to record '%s' as converted: %s\n", file, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(opts.messages, "Watching directory '%s' for CSVs...\n", dir)
+	for {
+		files, err := findCSVs(dir, opts.inputFormat, recursive)
+		if err != nil {
+			return err
+		}
+
+		var ready []string
+		for _, file := range files {
+			if converted[watchedKey(dir, file)] || unchanged(file, failed) {
+				continue
+			}
+			if csvReady(file, doneSuffix, sizes) {
+				ready = append(ready, file)
+			}
+		}
+		if len(ready) > 0 {
+			err := convertFiles(ctx, dir, ready, opts, stats, workers, record)
+			if errors.Is(err, errTooManyFailures) {
+				return err
+			}
+			// Files that failed have been reported, and are retried once
+			// they've changed.
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(opts.messages, "\nStopped watching '%s'.\n", dir)
+			return nil
+		case <-time.After(dirWatchInterval):
+		}
+	}
+}
+
+// Reports whether a CSV in a watched directory has finished arriving: whether its
+// `doneSuffix` file exists, or without one, whether it's the same size as when
+// last checked, according to `sizes`.
+func csvReady(file, doneSuffix string, sizes map[string]int64) bool {
+	if doneSuffix != "" {
+		_, err := os.Stat(file + doneSuffix)
+		return err == nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	last, ok := sizes[file]
+	sizes[file] = info.Size()
+	return ok && last == info.Size()
+}
+
+// Reports whether a CSV is in `modified`, and hasn't been modified since the time
+// it's listed with.
+func unchanged(file string, modified map[string]time.Time) bool {
+	last, ok := modified[file]
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(file)
+	return err == nil && info.ModTime().Equal(last)
+}
+
+// Returns how a converted CSV is listed in the watched file: by its path relative
+// to the watched directory, so that the list still applies when run from elsewhere.
+func watchedKey(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(file)
+}
+
+// Returns the CSVs listed in the watched file in `outputDir`, if there is one.
+func readWatched(outputDir string) (map[string]bool, error) {
+	converted := map[string]bool{}
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, watchedName))
+	if os.IsNotExist(err) {
+		return converted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line != "" {
+			converted[line] = true
+		}
+	}
+	return converted, nil
+}
+
+// Adds a CSV to the watched file in `outputDir`.
+func appendWatched(outputDir, rel string) error {
+	f, err := os.OpenFile(filepath.Join(outputDir, watchedName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, rel); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
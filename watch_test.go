@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Waits up to a few seconds for a file to exist, failing if it doesn't.
+func waitForFile(t testing.TB, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchConvertsAppendedRows(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	opts.watch = true
+	data := pngData(t)
+	path := writeTemp(t, "input.csv", "a,"+data+"\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := newSummary()
+	done := make(chan error)
+	go func() {
+		done <- convertFile(ctx, path, opts, stats)
+	}()
+	waitForFile(t, filepath.Join(opts.outputDir, "a.png"))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last row isn't finished, so it mustn't be converted yet.
+	if _, err := f.WriteString("b," + data + "\nc," + data[:10]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	waitForFile(t, filepath.Join(opts.outputDir, "b.png"))
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if stats.total != 2 || stats.success != 2 {
+		t.Errorf("expected rows a and b to be converted once each, got %s", stats)
+	}
+	if _, err := os.Stat(filepath.Join(opts.outputDir, "c.txt")); err == nil {
+		t.Error("expected the unfinished row not to be converted")
+	}
+}
+
+func TestWatchDirRetriesFailedFiles(t *testing.T) {
+	opts := testOptions(t.TempDir())
+	dir := t.TempDir()
+	data := pngData(t)
+	write := func(name, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed := func() map[string]bool {
+		t.Helper()
+		converted, err := readWatched(opts.outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return converted
+	}
+	// Without a data column, the first file fails.
+	write("bad.csv", "a\n")
+	write("bad.csv.done", "")
+	write("good.csv", "a,"+data+"\n")
+	write("good.csv.done", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- watchDir(ctx, dir, false, ".done", opts, newSummary(), 1)
+	}()
+	// The files are converted in order, so the bad one has been tried by the time
+	// the good one is listed.
+	waitForFile(t, filepath.Join(opts.outputDir, watchedName))
+	if converted := listed(); len(converted) != 1 || !converted["good.csv"] {
+		t.Errorf("expected only good.csv to be listed, got %v", converted)
+	}
+
+	// Once it's fixed, it's converted after all.
+	write("bad.csv", "a,"+data+"\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "bad.csv"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(opts.outputDir, "bad", "a.png"))
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if converted := listed(); len(converted) != 2 || !converted["bad.csv"] {
+		t.Errorf("expected both files to be listed once converted, got %v", converted)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Reads the rows of a sheet of an Excel workbook, like csv.Reader. Cells are read
+// as they're stored rather than as they're displayed, so numbers aren't rounded or
+// reformatted, and empty rows are skipped. The workbook must be closed once the
+// reader is no longer needed.
+type xlsxReader struct {
+	f    *excelize.File
+	rows *excelize.Rows
+	// The number of rows to ignore at the start of the sheet, and how many have
+	// been read.
+	skip int
+	row  int
+}
+
+// Opens the workbook read from `r`, to read the rows of `sheet`, or of its first
+// sheet if that's empty, after the first `skipRows` of them.
+func newXLSXReader(r io.Reader, sheet string, skipRows int) (*xlsxReader, error) {
+	f, err := excelize.OpenReader(r, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the workbook: %s", err)
+	}
+
+	sheets := f.GetSheetList()
+	if sheet == "" && len(sheets) > 0 {
+		sheet = sheets[0]
+	}
+	if index, _ := f.GetSheetIndex(sheet); index < 0 {
+		f.Close()
+		return nil, fmt.Errorf("the workbook has no sheet named '%s' (its sheets are %s)", sheet, strings.Join(sheets, ", "))
+	}
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &xlsxReader{f: f, rows: rows, skip: skipRows}, nil
+}
+
+func (x *xlsxReader) Read() ([]string, error) {
+	for x.rows.Next() {
+		x.row++
+		record, err := x.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if x.row > x.skip && len(record) > 0 {
+			return record, nil
+		}
+	}
+	if err := x.rows.Error(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// A workbook has no text of its rows to point to, so there's none to record for
+// them either.
+func (x *xlsxReader) InputOffset() int64 {
+	return 0
+}
+
+func (x *xlsxReader) Close() error {
+	x.rows.Close()
+	return x.f.Close()
+}